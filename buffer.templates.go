@@ -0,0 +1,27 @@
+package templates
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity above which buffers are dropped rather than returned to the pool,
+// so a single large page doesn't pin memory
+const maxPooledBuffer = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buff *bytes.Buffer) {
+	if buff.Cap() > maxPooledBuffer {
+		return
+	}
+
+	buff.Reset()
+	bufferPool.Put(buff)
+}
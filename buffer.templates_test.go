@@ -0,0 +1,52 @@
+package templates
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderBuffered(t *testing.T) {
+	tpl := newMapFSTemplate(t, map[string]string{
+		"half.tmpl": `<p>first half</p>{{ index .List 5 }}`,
+	})
+
+	data := map[string]any{"List": []int{1}, "Name": "philippta"}
+
+	buff := bytes.NewBuffer(nil)
+	require.Error(t, tpl.Render(buff, RenderOption{Template: "half", Data: data}))
+	assert.Equal(t, "<p>first half</p>", buff.String())
+
+	buff.Reset()
+	require.Error(t, tpl.Render(buff, RenderOption{Template: "half", Data: data, Buffered: true}))
+	assert.Empty(t, buff.String())
+
+	buff.Reset()
+	require.Error(t, tpl.RenderOOB(buff, RenderOption{Template: "solo", Data: data, Buffered: true}, OOBSwap{Block: "missing"}))
+	assert.Empty(t, buff.String())
+
+	buff.Reset()
+	require.NoError(t, tpl.Render(buff, RenderOption{Template: "solo", Data: data, Buffered: true}))
+	assert.Equal(t, "philippta, This is solo act!", buff.String())
+}
+
+func BenchmarkRender_buffered(b *testing.B) {
+	tpl, err := New("./testData", options)
+	require.NoError(b, err)
+
+	d := struct{ Name string }{Name: "philippta"}
+	for _, buffered := range []bool{false, true} {
+		option := RenderOption{Template: "profile", Data: d, Buffered: buffered}
+		b.Run(map[bool]string{false: "direct", true: "buffered"}[buffered], func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := tpl.Render(io.Discard, option); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
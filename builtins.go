@@ -2,9 +2,13 @@ package templates
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -21,13 +25,25 @@ func BuiltinInit(t *Template, options *TemplateOptions) error {
 
 	// register the svg helper when path to svg is provided
 	if options.PathToSVG != "" {
-		t.FuncMap["svg"] = SvgHelper(options.PathToSVG)
+		if options.FS != nil {
+			svgFS, err := fs.Sub(options.FS, filepath.ToSlash(filepath.Clean(options.PathToSVG)))
+			if err != nil {
+				return err
+			}
+			t.FuncMap["svg"] = SvgHelperFS(svgFS)
+		} else {
+			t.FuncMap["svg"] = SvgHelper(options.PathToSVG)
+		}
 	}
 
 	t.FuncMap["html"] = func(v string) template.HTML { return template.HTML(v) }
 	t.FuncMap["map"] = aMap
 	t.FuncMap["slice"] = makeSlice
 	t.FuncMap["component"] = t.component
+	t.FuncMap["_scope"] = scope
+	t.FuncMap["_capture"] = func(name string, data any) (template.HTML, error) {
+		return "", fmt.Errorf("template: %s can only be rendered from its own template", name)
+	}
 	t.FuncMap["replaceStr"] = replaceStr
 	t.FuncMap["ifZero"] = ifZero
 	t.FuncMap["attributeSet"] = attributes
@@ -41,19 +57,92 @@ func BuiltinInit(t *Template, options *TemplateOptions) error {
 	return nil
 }
 
-func (t *Template) component(name string, args map[any]any) template.HTML {
-	name += t.ext
-	tpl := t.componentTemplates.Lookup(name)
-	if tpl == nil {
-		return ""
+func (t *Template) component(name string, args map[any]any) (template.HTML, error) {
+	return t.snapshot().component(name, args)
+}
+
+// component renders the component name outside of a render, see renderComponent
+func (s *snapshot) component(name string, args map[any]any) (template.HTML, error) {
+	return s.renderComponent(binding{ctx: context.Background()}, name, args)
+}
+
+// renderComponent renders the component name for the render bound to b. unknown components render nothing
+// and execution errors are rendered in place of the component, unless the snapshot is strict or the error
+// ends the render
+func (s *snapshot) renderComponent(b binding, name string, args map[any]any) (template.HTML, error) {
+	components := s.components.Load()
+	if components.lookup(name+s.ext) == nil {
+		if s.strict {
+			return "", &ComponentError{Component: name, Err: errUnknownComponent}
+		}
+		return "", nil
+	}
+
+	inst, err := components.compiled.bind(b, components.ctx[name])
+	if err != nil {
+		return "", err
 	}
+	defer components.compiled.put(inst)
 
+	tpl := inst.tpl.Lookup(name + s.ext)
 	buff := bytes.NewBufferString("")
-	if err := tpl.Execute(buff, args); err != nil {
-		return template.HTML(err.Error())
+	err = executeComponentOf(components, tpl, b.writer(buff), args)
+	if err == nil {
+		return template.HTML(buff.String()), nil
+	}
+	if errors.Is(err, ErrOutputLimit) || errors.Is(err, ErrDepthLimit) || b.ctx.Err() != nil {
+		return "", err
+	}
+
+	err = s.sources.rewrite(err)
+	if s.strict {
+		cErr := &ComponentError{Component: name, Err: err}
+		if sm := s.sources.get(tpl.Name()); sm != nil {
+			cErr.File = sm.file
+		}
+		return "", cErr
+	}
+
+	return template.HTML(err.Error()), nil
+}
+
+// executeComponentOf executes the component tpl of components with args
+func executeComponentOf(components *componentSet, tpl *template.Template, out io.Writer, args map[any]any) error {
+	if components.legacy[tpl.Name()] && args["_isSelfClosing"] == false && args["children"] != nil {
+		// components that branch on _isEnd render their opening half, the children then their closing half
+		if err := executeComponent(tpl, out, args, false); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(out, fmt.Sprint(args["children"])); err != nil {
+			return err
+		}
+		return executeComponent(tpl, out, args, true)
+	}
+
+	return tpl.Execute(out, args)
+}
+
+func executeComponent(tpl *template.Template, out io.Writer, args map[any]any, isEnd bool) error {
+	tagArgs := make(map[any]any, len(args))
+	for k, v := range args {
+		tagArgs[k] = v
+	}
+	tagArgs["_isEnd"] = isEnd
+
+	return tpl.Execute(out, tagArgs)
+}
+
+// scope is the data passed to blocks captured from between component tags.
+// dot is wrapped in a slice, so it can be restored with range even when it's empty
+func scope(dot, root any, vars ...any) map[string]any {
+	retv := make(map[string]any, len(vars)/2+2)
+	retv["_dot"] = []any{dot}
+	retv["_root"] = root
+	for i := 0; i+1 < len(vars); i += 2 {
+		retv[fmt.Sprint(vars[i])] = vars[i+1]
 	}
 
-	return template.HTML(buff.String())
+	return retv
 }
 
 func aMap(args ...any) map[any]interface{} {
@@ -147,14 +236,18 @@ var reAttr = regexp.MustCompile(`([\w-]*) *= *["'][\w -]+["']`)
 
 // SvgHelper expects that the svg markup in the specified file has a class attribute, even if it's empty
 func SvgHelper(folder string) func(name string, class ...string) template.HTML {
+	return SvgHelperFS(os.DirFS(folder))
+}
+
+// SvgHelperFS is SvgHelper for svg files stored in the root of fSys
+func SvgHelperFS(fSys fs.FS) func(name string, class ...string) template.HTML {
 	return func(name string, class ...string) template.HTML {
 
 		cls := ""
 		if len(class) > 0 {
 			cls = class[0]
 		}
-		file := filepath.Join(folder, name+".svg")
-		contents, err := os.ReadFile(file)
+		contents, err := fs.ReadFile(fSys, name+".svg")
 		if err != nil {
 			return ""
 		}
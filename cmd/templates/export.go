@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mayowa/templates"
+	"gopkg.in/yaml.v3"
+)
+
+// fixtureExts are the extensions of the fixture files looked for next to a template, in order
+var fixtureExts = []string{".json", ".yaml", ".yml"}
+
+// exportError is the failure of a single page
+type exportError struct {
+	template string
+	err      error
+}
+
+// runExport renders every page under the root into an .html file in the output folder, with the
+// data of the fixture file next to it e.g. about.json or about.yaml for about.tmpl.
+// pages with dynamic segments are skipped
+func runExport(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	root := flags.String("root", ".", "folder holding the templates")
+	out := flags.String("out", "public", "folder the html files are written to")
+	ext := flags.String("ext", ".tmpl", "extension of the template files")
+	layout := flags.String("layout", "", "layout every page is rendered in")
+	svg := flags.String("svg", "./resources/svg", "folder holding the files of the svg func")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	tpl, err := templates.New(*root, &templates.TemplateOptions{Ext: *ext, PathToSVG: *svg})
+	if err != nil {
+		fmt.Fprintf(stderr, "templates: %v\n", err)
+		return 1
+	}
+
+	failed, err := export(tpl, *root, *out, templates.RenderOption{Layout: *layout}, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "templates: %v\n", err)
+		return 1
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(stderr, "templates: %d page(s) failed to export:\n", len(failed))
+		for _, f := range failed {
+			fmt.Fprintf(stderr, "  %s: %v\n", f.template, f.err)
+		}
+		return 1
+	}
+
+	return 0
+}
+
+// export renders the pages of tpl into dir and returns the pages that failed
+func export(tpl *templates.Template, root, dir string, option templates.RenderOption, stdout io.Writer) ([]exportError, error) {
+	router, err := tpl.Router(option)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []exportError
+	for _, route := range router.Routes() {
+		if strings.Contains(route.Pattern, "[") {
+			fmt.Fprintf(stdout, "skipped %s: dynamic route %s\n", route.Template, route.Pattern)
+			continue
+		}
+
+		file := filepath.Join(dir, filepath.FromSlash(route.Template)+".html")
+		if err = exportPage(tpl, root, file, route.Template, option); err != nil {
+			failed = append(failed, exportError{template: route.Template, err: err})
+			continue
+		}
+
+		fmt.Fprintf(stdout, "wrote %s\n", file)
+	}
+
+	return failed, nil
+}
+
+func exportPage(tpl *templates.Template, root, file, name string, option templates.RenderOption) error {
+	data, err := loadFixture(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+
+	buff := new(bytes.Buffer)
+	option.Template = name
+	option.Data = data
+	if err = tpl.Render(buff, option); err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, buff.Bytes(), 0o644)
+}
+
+// loadFixture decodes the first fixture file found for the template at path (without its extension),
+// returning nil when there is none
+func loadFixture(path string) (any, error) {
+	for _, ext := range fixtureExts {
+		b, err := os.ReadFile(path + ext)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var data any
+		if ext == ".json" {
+			err = json.Unmarshal(b, &data)
+		} else {
+			err = yaml.Unmarshal(b, &data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", filepath.Base(path+ext), err)
+		}
+
+		return data, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+	}
+}
+
+func TestRunExport(t *testing.T) {
+	root, out := t.TempDir(), t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"base.tmpl":            `<main>{{ block "content" . }}{{ end }}</main>`,
+		"index.tmpl":           `{{/* extends "base" */}}{{ define "content" }}<Hi name="{{ .Name }}" />{{ end }}`,
+		"index.json":           `{"Name": "ayo"}`,
+		"about.tmpl":           `about {{ template "footer" . }}`,
+		"about.yaml":           "Year: 2024\n",
+		"icon.tmpl":            `<i>{{ svg "dot" }}</i>`,
+		"svg/dot.svg":          `<svg><circle r="1"/></svg>`,
+		"shared/footer.tmpl":   `{{ define "footer" }}&copy; {{ .Year }}{{ end }}`,
+		"components/hi.tmpl":   `<b>hi {{ .name }}</b>`,
+		"veggies/[id].tmpl":    `veggie {{ .id }}`,
+		"veggies/carrots.tmpl": `carrots`,
+		"veggies/carrots.yml":  "- orange\n",
+		"broken/data.tmpl":     `{{ index .List 5 }}`,
+		"broken/data.json":     `{"List": [1]}`,
+		"broken/fixture.tmpl":  `bad fixture`,
+		"broken/fixture.json":  `{"List": `,
+	})
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := run([]string{"export", "-root", root, "-out", out, "-svg", filepath.Join(root, "svg")}, stdout, stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "2 page(s) failed to export")
+	assert.Contains(t, stderr.String(), "broken/data: ")
+	assert.Contains(t, stderr.String(), "broken/fixture: fixture fixture.json: ")
+	assert.Contains(t, stdout.String(), "skipped veggies/[id]: dynamic route /veggies/[id]")
+
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		return string(b)
+	}
+	assert.Equal(t, "<main><b>hi ayo</b></main>", read("index.html"))
+	assert.Equal(t, "about &copy; 2024", read("about.html"))
+	assert.Equal(t, "carrots", read("veggies/carrots.html"))
+	assert.Equal(t, `<i><svg><circle r="1"/></svg></i>`, read("icon.html"))
+
+	for _, name := range []string{"base.html", "broken/data.html", "broken/fixture.html", "veggies/[id].html"} {
+		assert.NoFileExists(t, filepath.Join(out, name))
+	}
+}
+
+func TestRun(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	assert.Equal(t, 2, run(nil, stdout, stderr))
+	assert.Equal(t, 2, run([]string{"serve"}, stdout, stderr))
+	assert.Contains(t, stderr.String(), `unknown command "serve"`)
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"index.tmpl": `home`})
+	out := filepath.Join(t.TempDir(), "public")
+	assert.Equal(t, 0, run([]string{"export", "-root", root, "-out", out}, stdout, stderr))
+	assert.FileExists(t, filepath.Join(out, "index.html"))
+}
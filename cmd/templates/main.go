@@ -0,0 +1,39 @@
+// Command templates works with a tree of templates from the command line.
+//
+//	templates export -root ./site -out ./public
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: templates <command> [flags]
+
+commands:
+  export  render every page under a root into static html files
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command in args and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "export":
+		return runExport(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "templates: unknown command %q\n\n%s", args[0], usage)
+	return 2
+}
@@ -5,106 +5,405 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
-	"io/fs"
-	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
-)
 
-func (t *Template) processComponentsInTemplate(contents *[]byte) error {
+	"github.com/mayowa/templates/scanner"
+)
 
-	if t.componentTemplates == nil {
-		return nil
-	}
+// slotTag is the tag used to pass named content to a component e.g. <Slot name="footer">...</Slot>
+const slotTag = "Slot"
 
-	return processComponents(contents)
-}
+// rewriteComponents rewrites the component tags in src into calls to the component builtin,
+// and returns the spans mapping the output back to src, nil if src holds no tags.
+// the content between a pair of tags is moved into a block named after the template name,
+// and passed to the component as .children along with .slots, the <Slot name="..."> tags within it.
+// when the content spans template actions (e.g. the opening tag is in an if block and the closing
+// tag is in another), defines templates or assigns variables declared before it, the opening and
+// closing tags are rendered separately using _isEnd instead.
+// src is read in a single pass, the body of every open tag is kept on a stack until it is closed
+func rewriteComponents(name string, src []byte) ([]byte, []srcSpan, error) {
+	w := &componentWriter{name: name, src: src, declared: map[string]int{}}
+	scan := scanner.NewScanner(bytes.NewReader(w.src))
+	stack := []*componentFrame{{}}
 
-func processComponents(contents *[]byte) error {
-	buf := bytes.NewBuffer(nil)
-	var tags []*Tag
+	pos := 0
+	found := false
 	for {
-		cTag, err := findNextTag(*contents)
+		head, err := scan.ParseTagHead()
 		if err != nil {
-			return err
+			return nil, nil, tagError(err)
 		}
-		if cTag == nil {
+		if head == nil {
 			break
 		}
 
-		if cTag.IsEnd {
-			startTag := findStartTag(cTag, tags)
-			if startTag == nil {
-				return errors.New("template: unable to find start tag for " + cTag.Name)
-			}
+		found = true
+		tag := newTag(head)
+		w.text(stack[len(stack)-1], pos, tag.loc[0])
+		pos = tag.loc[1]
 
-			cTag.Args = startTag.Args
+		if stack, err = w.tag(stack, tag); err != nil {
+			return nil, nil, err
 		}
-		tags = append(tags, cTag)
+	}
+	if !found {
+		return src, nil, nil
+	}
+	w.text(stack[len(stack)-1], pos, len(w.src))
 
-		cName := strings.ToLower(cTag.Name)
-		args := fmt.Sprintf(`(map "_isSelfClosing" %v "_isEnd" %v %s)`, cTag.IsSelfClosing, cTag.IsEnd, cTag.Args.ArgPairs())
-		buf.WriteString(`{{ component "` + cName + `" ` + args + ` }}`)
+	var err error
+	for len(stack) > 1 {
+		if stack, err = w.unwind(stack); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	out := &stack[0].body
+	out.writeBuf(&w.blocks)
+	return out.Bytes(), out.spans, nil
+}
+
+// componentFrame is an open tag along with its body, rewritten up to the current position
+type componentFrame struct {
+	open  *Tag
+	body  sourceBuffer
+	slots []componentSlot
 
-		// replace rendered component with tag block
-		start := cTag.loc[0]
-		end := cTag.loc[1]
-		*contents = append((*contents)[:start], append(buf.Bytes(), (*contents)[end:]...)...)
-		// tHalf := (*contents)[:start]
-		// bHalf := (*contents)[end:]
-		// *contents = append(tHalf, append(buf.Bytes(), bHalf...)...)
-		buf.Reset()
+	// depth is the number of block actions left open in the body,
+	// and low is the lowest depth reached. else actions close and reopen a block
+	depth, low int
+	// inPlace is set when the body defines templates or assigns variables declared before it,
+	// neither of which works from a captured block
+	inPlace bool
+}
+
+// componentSlot is the body of a <Slot> tag
+type componentSlot struct {
+	name string
+	body *sourceBuffer
+}
+
+// balanced reports whether every block action opened in the body is also closed in the body
+func (f *componentFrame) balanced() bool {
+	return f.depth == 0 && f.low >= 0
+}
+
+// captured reports whether the body can be moved into a block
+func (f *componentFrame) captured() bool {
+	return f.balanced() && !f.inPlace
+}
+
+// merge adds the block actions of a frame nested in f
+func (f *componentFrame) merge(child *componentFrame) {
+	f.lower(f.depth + child.low)
+	f.depth += child.depth
+	f.inPlace = f.inPlace || child.inPlace
+}
+
+func (f *componentFrame) lower(depth int) {
+	if depth < f.low {
+		f.low = depth
 	}
+}
 
-	return nil
+type componentWriter struct {
+	name   string
+	src    []byte
+	blocks sourceBuffer
+	count  int
+	// declared holds the offset of the first declaration of every variable seen so far
+	declared map[string]int
+	// unwound holds the tags closed because an enclosing tag was closed first,
+	// a closing tag found later is paired with the last one
+	unwound map[string][]*Tag
 }
 
-func findStartTag(cTag *Tag, tags []*Tag) *Tag {
-	var pair int
-	for i := len(tags) - 1; i >= 0; i-- {
-		t := tags[i]
-		if t.Name != cTag.Name || t.IsSelfClosing {
-			continue
-		}
-		if t.IsEnd {
-			pair++
-			continue
+var (
+	errSlotPlacement = fmt.Errorf("<%s> must be placed between the opening and closing tags of a component", slotTag)
+	errNoStartTag    = errors.New("unable to find start tag")
+	errSlotInPlace   = errors.New("the content of a component with slots cannot define templates or assign variables declared before it")
+)
+
+func componentError(tag *Tag, err error) error {
+	return &ComponentError{Component: tag.Name, Line: tag.line, Err: err}
+}
+
+// text writes src[start:end], which holds no tags, to the body of f
+func (w *componentWriter) text(f *componentFrame, start, end int) {
+	src := w.src[start:end]
+	f.body.writeSrc(src, start)
+
+	for _, action := range reAction.FindAll(src, -1) {
+		if f.open != nil && w.inPlace(f, action) {
+			f.inPlace = true
 		}
-		if t.IsEnd == false && pair > 0 {
-			pair--
-			continue
+
+		switch {
+		case reOpenBlock.Match(action):
+			f.depth++
+		case reEndBlock.Match(action):
+			f.depth--
+		case reElse.Match(action):
+			f.lower(f.depth - 1)
 		}
+		f.lower(f.depth)
+	}
 
-		if pair < 0 {
-			return nil
+	for _, m := range reVarDecl.FindAllSubmatchIndex(src, -1) {
+		for i := 2; i < len(m); i += 2 {
+			if m[i] < 0 {
+				continue
+			}
+			if v := string(src[m[i]:m[i+1]]); !w.hasDeclared(v) {
+				w.declared[v] = start + m[0]
+			}
 		}
+	}
+}
 
-		if t.Name == cTag.Name {
-			return t
+// inPlace reports whether action, in the body of f, defines a template or assigns a variable
+// declared before the opening tag of f
+func (w *componentWriter) inPlace(f *componentFrame, action []byte) bool {
+	if reDefine.Match(action) {
+		return true
+	}
+
+	for _, m := range reVarAssign.FindAllSubmatch(maskQuoted(action), -1) {
+		for _, v := range m[1:] {
+			if pos, ok := w.declared[string(v)]; ok && pos < f.open.loc[0] {
+				return true
+			}
 		}
 	}
 
-	return nil
+	return false
 }
 
-func componentTemplates(folder, ext string, funcMap template.FuncMap, readFile readFileFunc) (*template.Template, error) {
-	t := template.New("").Funcs(funcMap)
+func (w *componentWriter) hasDeclared(v string) bool {
+	_, ok := w.declared[v]
+	return ok
+}
+
+// tag handles the next tag in the source and returns the updated stack
+func (w *componentWriter) tag(stack []*componentFrame, tag *Tag) ([]*componentFrame, error) {
+	top := stack[len(stack)-1]
 
-	var filenames []string
-	err := filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
-		if d.IsDir() {
-			return nil
+	switch {
+	case tag.IsSelfClosing:
+		if tag.Name == slotTag {
+			return nil, componentError(tag, errSlotPlacement)
 		}
+		top.body.writeGen(componentCall(tag, ""), tag)
+		return stack, nil
+
+	case !tag.IsEnd:
+		if tag.Name == slotTag && (top.open == nil || top.open.Name == slotTag) {
+			return nil, componentError(tag, errSlotPlacement)
+		}
+		return append(stack, &componentFrame{open: tag}), nil
+	}
 
-		if filepath.Ext(path) != ext {
-			return nil
+	idx := len(stack) - 1
+	for idx > 0 && stack[idx].open.Name != tag.Name {
+		idx--
+	}
+
+	if idx == 0 {
+		// the opening tag was closed by an enclosing tag
+		unwound := w.unwound[tag.Name]
+		if len(unwound) == 0 {
+			return nil, componentError(tag, errNoStartTag)
 		}
+		tag.Args = unwound[len(unwound)-1].Args
+		w.unwound[tag.Name] = unwound[:len(unwound)-1]
+
+		top.body.writeGen(componentCall(tag, ""), tag)
+		return stack, nil
+	}
 
-		filenames = append(filenames, path)
-		return nil
+	var err error
+	for len(stack)-1 > idx {
+		if stack, err = w.unwind(stack); err != nil {
+			return nil, err
+		}
+	}
+
+	f := stack[idx]
+	stack = stack[:idx]
+	parent := stack[idx-1]
+	parent.merge(f)
+	tag.Args = f.open.Args
+
+	switch {
+	case f.open.Name == slotTag:
+		parent.slots = append(parent.slots, componentSlot{name: f.open.Args["name"], body: &f.body})
+
+	case !f.captured():
+		if len(f.slots) > 0 && f.inPlace {
+			return nil, componentError(f.open, errSlotInPlace)
+		}
+		if len(f.slots) > 0 {
+			return nil, componentError(f.open, errSlotPlacement)
+		}
+		parent.body.writeGen(componentCall(f.open, ""), f.open)
+		parent.body.writeBuf(&f.body)
+		parent.body.writeGen(componentCall(tag, ""), tag)
+
+	default:
+		parent.body.writeGen(componentCall(f.open, w.capture(f)), f.open)
+	}
+
+	return stack, nil
+}
+
+// unwind pops a tag that was never closed, its body is written to the enclosing tag
+func (w *componentWriter) unwind(stack []*componentFrame) ([]*componentFrame, error) {
+	f := stack[len(stack)-1]
+	stack = stack[:len(stack)-1]
+	if f.open.Name == slotTag {
+		return nil, &UnclosedTagError{Tag: slotTag, Line: f.open.line}
+	}
+	if len(f.slots) > 0 {
+		return nil, componentError(f.open, errSlotPlacement)
+	}
+
+	parent := stack[len(stack)-1]
+	parent.merge(f)
+	parent.body.writeGen(componentCall(f.open, ""), f.open)
+	parent.body.writeBuf(&f.body)
+
+	if w.unwound == nil {
+		w.unwound = map[string][]*Tag{}
+	}
+	w.unwound[f.open.Name] = append(w.unwound[f.open.Name], f.open)
+
+	return stack, nil
+}
+
+// capture moves the body and slots of f into blocks,
+// and returns the component arguments that render them
+func (w *componentWriter) capture(f *componentFrame) string {
+	children := w.block(f.open, &f.body)
+
+	var slots []string
+	for _, slot := range f.slots {
+		slots = append(slots, fmt.Sprintf("%q %s", slot.name, w.block(f.open, slot.body)))
+	}
+
+	return fmt.Sprintf(`"children" %s "slots" (map %s)`, children, strings.Join(slots, " "))
+}
+
+var (
+	reAction    = regexp.MustCompile(`(?s){{.*?}}`)
+	reVariable  = regexp.MustCompile(`\$([a-zA-Z_]\w*)`)
+	reRootVar   = regexp.MustCompile(`\$([^\w]|$)`)
+	reVarDecl   = regexp.MustCompile(`\$(\w+)\s*(?:,\s*\$(\w+)\s*)?:?=`)
+	reVarAssign = regexp.MustCompile(`\$(\w+)\s*(?:,\s*\$(\w+)\s*)?=`)
+	reDefine    = regexp.MustCompile(`^{{-?\s*define\b`)
+	reOpenBlock = regexp.MustCompile(`^{{-?\s*(if|range|with|block|define)\b`)
+	reEndBlock  = regexp.MustCompile(`^{{-?\s*end\b`)
+	reElse      = regexp.MustCompile(`^{{-?\s*else\b`)
+)
+
+// blockDefine opens the blocks the content between component tags is moved into
+const blockDefine = "{{ define "
+
+// block defines a template containing src and returns the call that renders it.
+// variables used in src that are declared before tag are passed along to the block,
+// and $ is rewritten to refer to the data of the template the block was taken from
+func (w *componentWriter) block(tag *Tag, src *sourceBuffer) string {
+	w.count++
+	name := fmt.Sprintf("_%s:%s:%d", w.name, strings.ToLower(tag.Name), w.count)
+
+	declared := func(v string) bool {
+		pos, ok := w.declared[v]
+		return ok && pos < tag.loc[0]
+	}
+
+	// actions never span tags, so each span holds whole actions
+	var vars []string
+	body := &sourceBuffer{}
+	src.each(func(p []byte, span srcSpan) {
+		pos := 0
+		for _, loc := range reAction.FindAllIndex(p, -1) {
+			// strings and comments are masked, so only variables are matched
+			action := maskQuoted(p[loc[0]:loc[1]])
+			for _, m := range reVariable.FindAllSubmatch(action, -1) {
+				if v := string(m[1]); declared(v) && !slices.Contains(vars, v) {
+					vars = append(vars, v)
+				}
+			}
+
+			for _, m := range reRootVar.FindAllIndex(action, -1) {
+				at := loc[0] + m[0] + 1
+				body.writeSpan(p[pos:at], span, pos)
+				body.writeSpan([]byte("_root"), span, at)
+				pos = at
+			}
+		}
+		body.writeSpan(p[pos:], span, pos)
 	})
-	if err != nil {
-		return nil, err
+
+	header := blockDefine + `"` + name + `" }}{{ $_root := ._root }}`
+	args := ""
+	for _, v := range vars {
+		header += fmt.Sprintf(`{{ $%s := .%s }}`, v, v)
+		args += fmt.Sprintf(` %q $%s`, v, v)
+	}
+	w.blocks.writeGen(header+`{{ range ._dot }}`, tag)
+	w.blocks.writeBuf(body)
+	w.blocks.writeGen(`{{ end }}{{ end }}`, tag)
+
+	return fmt.Sprintf(`(_capture %q (_scope . $%s))`, name, args)
+}
+
+// maskQuoted returns a copy of action with the contents of its strings, characters and comments
+// blanked out, leaving everything else at the same offsets
+func maskQuoted(action []byte) []byte {
+	masked := slices.Clone(action)
+	var quote byte
+	for i := 0; i < len(action); i++ {
+		c := action[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+				continue
+			}
+			if c == '\\' && quote != '`' && i+1 < len(action) {
+				masked[i] = ' '
+				i++
+			}
+			masked[i] = ' '
+		case c == '"' || c == '`' || c == '\'':
+			quote = c
+		case c == '/' && i+1 < len(action) && action[i+1] == '*':
+			end := bytes.Index(action[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(action)
+			} else {
+				end += i + 4
+			}
+			for ; i < end; i++ {
+				masked[i] = ' '
+			}
+			i--
+		}
 	}
 
-	return parseFiles(t, readFile, funcMap, filenames)
+	return masked
+}
+
+// componentCall renders the call to the component builtin for tag
+func componentCall(tag *Tag, extra string) string {
+	args := fmt.Sprintf(`(map "_isSelfClosing" %v "_isEnd" %v %s %s)`, tag.IsSelfClosing, tag.IsEnd, tag.Args.ArgPairs(), extra)
+	return `{{ component "` + strings.ToLower(tag.Name) + `" ` + args + ` }}`
+}
+
+func componentTemplates(filenames []string, funcMap template.FuncMap, sources *sourceMaps, readFile readFileFunc) (*template.Template, error) {
+	t := template.New("").Funcs(funcMap)
+
+	return parseFiles(t, readFile, funcMap, sources, filenames)
 }
@@ -1,68 +1,152 @@
 package templates
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func Test_findStartTag(t *testing.T) {
-
+func Test_rewriteComponents(t *testing.T) {
 	tests := []struct {
-		name string
-		cTag *Tag
-		tags []*Tag
-		want *Tag
+		name    string
+		src     string
+		want    string
+		wantErr string
 	}{
 		{
-			name: "best case",
-			cTag: &Tag{Name: "foo", IsEnd: true},
-			tags: []*Tag{
-				{Name: "foo", IsEnd: false},
-			},
-			want: &Tag{Name: "foo", IsEnd: false},
+			name: "self closing",
+			src:  `<Card title="hi" />`,
+			want: `{{ component "card" (map "_isSelfClosing" true "_isEnd" false "title" "hi" ) }}`,
+		},
+		{
+			name: "children",
+			src:  `{{ $a := 1 }}<Card>{{ $a }} {{ $.b }}</Card>`,
+			want: `{{ $a := 1 }}{{ component "card" (map "_isSelfClosing" false "_isEnd" false  "children" (_capture "_page:card:1" (_scope . $ "a" $a)) "slots" (map )) }}` +
+				`{{ define "_page:card:1" }}{{ $_root := ._root }}{{ $a := .a }}{{ range ._dot }}{{ $a }} {{ $_root.b }}{{ end }}{{ end }}`,
+		},
+		{
+			name: "dollar in strings and comments",
+			src:  "<Card>{{ printf \"$%d \\\"$\\\" %s\" 5 `$` }}{{/* $ */}}{{ $ }}</Card>",
+			want: `{{ component "card" (map "_isSelfClosing" false "_isEnd" false  "children" (_capture "_page:card:1" (_scope . $)) "slots" (map )) }}` +
+				"{{ define \"_page:card:1\" }}{{ $_root := ._root }}{{ range ._dot }}{{ printf \"$%d \\\"$\\\" %s\" 5 `$` }}{{/* $ */}}{{ $_root }}{{ end }}{{ end }}",
+		},
+		{
+			name: "slots",
+			src:  `<Card>body<Slot name="footer">foot</Slot></Card>`,
+			want: `{{ component "card" (map "_isSelfClosing" false "_isEnd" false  "children" (_capture "_page:card:1" (_scope . $)) "slots" (map "footer" (_capture "_page:card:2" (_scope . $)))) }}` +
+				`{{ define "_page:card:1" }}{{ $_root := ._root }}{{ range ._dot }}body{{ end }}{{ end }}` +
+				`{{ define "_page:card:2" }}{{ $_root := ._root }}{{ range ._dot }}foot{{ end }}{{ end }}`,
+		},
+		{
+			name: "tags inside actions",
+			src:  `{{ "<Card />" }}{{/* <Card> */}}<p title="a > b">x</p>`,
+			want: `{{ "<Card />" }}{{/* <Card> */}}<p title="a > b">x</p>`,
+		},
+		{
+			name: "tags split across actions",
+			src:  `{{ if .a }}<Card>{{ else }}</Card>{{ end }}`,
+			want: `{{ if .a }}{{ component "card" (map "_isSelfClosing" false "_isEnd" false  ) }}{{ else }}{{ component "card" (map "_isSelfClosing" false "_isEnd" true  ) }}{{ end }}`,
+		},
+		{
+			name: "define in children",
+			src:  `<Box>{{ define "x" }}x{{ end }}</Box>`,
+			want: `{{ component "box" (map "_isSelfClosing" false "_isEnd" false  ) }}{{ define "x" }}x{{ end }}{{ component "box" (map "_isSelfClosing" false "_isEnd" true  ) }}`,
+		},
+		{
+			name: "assignment to an outer variable",
+			src:  `{{ $n := 0 }}<Card><Box>{{ $n = 1 }}</Box></Card>`,
+			want: `{{ $n := 0 }}{{ component "card" (map "_isSelfClosing" false "_isEnd" false  ) }}{{ component "box" (map "_isSelfClosing" false "_isEnd" false  ) }}{{ $n = 1 }}` +
+				`{{ component "box" (map "_isSelfClosing" false "_isEnd" true  ) }}{{ component "card" (map "_isSelfClosing" false "_isEnd" true  ) }}`,
 		},
 		{
-			name: "nested other tag",
-			cTag: &Tag{Name: "foo", IsEnd: true},
-			tags: []*Tag{
-				{Name: "foo", IsEnd: false},
-				{Name: "bar", IsEnd: false},
-				{Name: "bar", IsEnd: true},
-			},
-			want: &Tag{Name: "foo", IsEnd: false},
+			name: "assignment to an inner variable",
+			src:  `{{ $n := 0 }}<Card>{{ $m := 0 }}{{ $m = 1 }}{{ "$n = 1" }}</Card>`,
+			want: `{{ $n := 0 }}{{ component "card" (map "_isSelfClosing" false "_isEnd" false  "children" (_capture "_page:card:1" (_scope . $)) "slots" (map )) }}` +
+				`{{ define "_page:card:1" }}{{ $_root := ._root }}{{ range ._dot }}{{ $m := 0 }}{{ $m = 1 }}{{ "$n = 1" }}{{ end }}{{ end }}`,
 		},
 		{
-			name: "nested same tag",
-			cTag: &Tag{Name: "foo", IsEnd: true},
-			tags: []*Tag{
-				{Name: "foo", IsEnd: false, loc: []int{0, 1}},
-				{Name: "bar", IsEnd: false},
-				{Name: "foo", IsEnd: false},
-				{Name: "lala", IsSelfClosing: true},
-				{Name: "foo", IsEnd: true},
-				{Name: "bar", IsEnd: true},
-			},
-			want: &Tag{Name: "foo", IsEnd: false, loc: []int{0, 1}},
+			name:    "define in a component with slots",
+			src:     `<Card>{{ define "x" }}x{{ end }}<Slot name="footer">foot</Slot></Card>`,
+			wantErr: "template: line 1: component Card: the content of a component with slots cannot define templates or assign variables declared before it",
 		},
 		{
-			name: "unbalanced nesting",
-			cTag: &Tag{Name: "foo", IsEnd: true},
-			tags: []*Tag{
-				{Name: "foo", loc: []int{0, 1}},
-				{Name: "bar"},
-				{Name: "foo"},
-				{Name: "foo", IsEnd: true},
-				{Name: "foo", IsEnd: true},
-				{Name: "bar", IsEnd: true},
-			},
-			want: nil,
+			name:    "slot outside a component",
+			src:     `<Slot name="footer">foot</Slot>`,
+			wantErr: "template: line 1: component Slot: <Slot> must be placed between the opening and closing tags of a component",
+		},
+		{
+			name:    "unbalanced tags",
+			src:     `<Card></Card></Card>`,
+			wantErr: "template: line 1: component Card: unable to find start tag",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equalf(t, tt.want, findStartTag(tt.cTag, tt.tags), "findStartTag(%v, %v)", tt.cTag, tt.tags)
+			out, _, err := rewriteComponents("page", []byte(tt.src))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
+
+func TestComponents_inPlace(t *testing.T) {
+	mfs := fstest.MapFS{
+		"site/components/box.tmpl": {Data: []byte(`{{ if ._isEnd }}</div>{{ else }}<div>{{ end }}`)},
+	}
+	tpl, err := New("site", &TemplateOptions{FS: mfs})
+	require.NoError(t, err)
+
+	out, err := tpl.String("", `<Box>{{ define "x" }}def-x{{ end }}</Box>{{ template "x" }}`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `<div></div>def-x`, out)
+
+	// assignments in the children are seen after the closing tag
+	out, err = tpl.String("", `{{ $n := 0 }}<Box>{{ $n = 1 }}</Box>{{ $n }}`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `<div></div>1`, out)
+}
+
+// componentPage returns a page with n cards, each holding a few nested components
+func componentPage(n int) []byte {
+	var b strings.Builder
+	b.WriteString(`{{ $title := .Title }}<main>`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `
+	<section id="s%d">
+		{{ if .Show }}<Hi name="{{ $title }}" />{{ end }}
+		<Card title="card %d">
+			<Box title="box"><Select name="s" value="{{ .Value }}" /></Box>
+			{{ range .Items }}<p>{{ . }}</p>{{ end }}
+			<Slot name="footer"><Hi name="footer" /></Slot>
+		</Card>
+	</section>`, i, i)
+	}
+	b.WriteString(`</main>`)
+
+	return []byte(b.String())
+}
+
+func BenchmarkRewriteComponents(b *testing.B) {
+	for _, n := range []int{10, 100, 500} {
+		src := componentPage(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.SetBytes(int64(len(src)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := rewriteComponents("page", src); err != nil {
+					b.Fatal(err)
+				}
+			}
 		})
 	}
 }
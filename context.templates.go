@@ -0,0 +1,274 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"text/template/parse"
+)
+
+// compiled is a template in the cache. html/template cannot clone a template once it has executed,
+// so it is never executed itself: renders that bind neither funcs nor a ctx the templates use share
+// a single clone, and the others take an instance, a clone with funcs of its own bound to the render
+type compiled struct {
+	tpl *template.Template
+	// funcs are the funcs tpl was parsed with
+	funcs template.FuncMap
+	// s renders the components tpl uses
+	s *snapshot
+	// usesCtx is set when the templates call ctx or _step, and components lists the components they call.
+	// dynamic is set when they call a component by a name that is not a literal
+	usesCtx    bool
+	components []string
+	dynamic    bool
+
+	once      sync.Once
+	shared    *instance
+	sharedErr error
+	instances sync.Pool
+}
+
+func newCompiled(tpl *template.Template, s *snapshot) *compiled {
+	c := &compiled{tpl: tpl, funcs: s.funcMap, s: s, components: componentCalls(tpl)}
+	for _, tmpl := range tpl.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		walkNodes(tmpl.Tree.Root, func(cmd *parse.CommandNode) {
+			if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "component" {
+				_, literal := componentName(cmd)
+				c.dynamic = c.dynamic || !literal
+			}
+			c.usesCtx = c.usesCtx || callsCtx(cmd)
+		})
+	}
+
+	return c
+}
+
+// binding is what a render binds to the instances it renders with
+type binding struct {
+	ctx context.Context
+	// funcs replace those the template was parsed with
+	funcs template.FuncMap
+	// limit is the most bytes a block captured by the render, or a component it renders, may output when set
+	limit int
+	// maxDepth is how deep captured blocks may nest when set, each is executed on its own so
+	// the depth limit of text/template does not apply to them
+	maxDepth int
+}
+
+// instance is a clone of a compiled template for a single render at a time, or the clone renders share
+type instance struct {
+	tpl *template.Template
+	binding
+	shared bool
+	// depth is the number of captured blocks being rendered
+	depth int
+	// bound are the funcs bound to the instance itself
+	bound template.FuncMap
+}
+
+// get returns the instance for a render bound to ctx, with funcs replacing those of the FuncMap
+func (c *compiled) get(ctx context.Context, funcs template.FuncMap) (*instance, error) {
+	for name, fn := range funcs {
+		if err := c.checkOverlay(name, fn); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.bind(binding{ctx: ctx, funcs: funcs}, c.bindsCtx())
+}
+
+// bindsCtx reports whether the templates, or the components they call, use the ctx of the render
+func (c *compiled) bindsCtx() bool {
+	if c.usesCtx {
+		return true
+	}
+
+	components := c.s.components.Load()
+	if components == nil {
+		return false
+	}
+	if c.dynamic {
+		return len(components.ctx) > 0
+	}
+
+	return slices.ContainsFunc(c.components, func(name string) bool { return components.ctx[name] })
+}
+
+// bind returns the instance for a render bound to b, with funcs that are already checked.
+// usesCtx reports whether what is rendered uses ctx
+func (c *compiled) bind(b binding, usesCtx bool) (*instance, error) {
+	if len(b.funcs) == 0 && b.limit == 0 && b.maxDepth == 0 && (!usesCtx || b.ctx == context.Background()) {
+		c.once.Do(func() {
+			var tpl *template.Template
+			if tpl, c.sharedErr = c.tpl.Clone(); c.sharedErr == nil {
+				tpl.Funcs(template.FuncMap{"_capture": captureFunc(tpl), "_step": noStep})
+				c.shared = &instance{tpl: tpl, binding: binding{ctx: context.Background()}, shared: true}
+			}
+		})
+		return c.shared, c.sharedErr
+	}
+
+	return c.instance(b)
+}
+
+// instance returns an instance bound to b, with funcs that are already checked replacing
+// those of the FuncMap, cloning the template when none is free. components rendered by the
+// instance are bound to the same render
+func (c *compiled) instance(b binding) (*instance, error) {
+	inst, ok := c.instances.Get().(*instance)
+	if !ok {
+		tpl, err := c.tpl.Clone()
+		if err != nil {
+			return nil, err
+		}
+
+		inst = &instance{tpl: tpl}
+		inst.bound = template.FuncMap{
+			"ctx":      func() context.Context { return inst.ctx },
+			"_capture": inst.capture,
+			"_step":    func() (bool, error) { return true, inst.ctx.Err() },
+			"component": func(name string, args map[any]any) (template.HTML, error) {
+				return c.s.renderComponent(inst.binding, name, args)
+			},
+		}
+		tpl.Funcs(inst.bound)
+	}
+
+	inst.binding = b
+	if len(b.funcs) > 0 {
+		inst.tpl.Funcs(b.funcs)
+	}
+
+	return inst, nil
+}
+
+// capture is the _capture builtin of an instance, blocks are captured within the limits of the render
+func (inst *instance) capture(name string, data any) (template.HTML, error) {
+	if inst.maxDepth > 0 && inst.depth >= inst.maxDepth {
+		return "", ErrDepthLimit
+	}
+	inst.depth++
+	defer func() { inst.depth-- }()
+
+	buff := new(bytes.Buffer)
+	if err := inst.tpl.ExecuteTemplate(inst.writer(buff), name, data); err != nil {
+		return "", err
+	}
+
+	return template.HTML(buff.String()), nil
+}
+
+// writer returns w limited to the output and the context of the render
+func (b binding) writer(w io.Writer) io.Writer {
+	if b.limit == 0 && b.ctx.Done() == nil {
+		return w
+	}
+
+	return &limitWriter{ctx: b.ctx, w: w, max: b.limit}
+}
+
+// put returns inst to the pool, with the funcs it was given by get restored
+func (c *compiled) put(inst *instance) {
+	if inst.shared {
+		return
+	}
+
+	if len(inst.funcs) > 0 {
+		restore := make(template.FuncMap, len(inst.funcs))
+		for name := range inst.funcs {
+			if fn, found := inst.bound[name]; found {
+				restore[name] = fn
+			} else {
+				restore[name] = c.funcs[name]
+			}
+		}
+		inst.tpl.Funcs(restore)
+	}
+
+	inst.binding, inst.depth = binding{}, 0
+	c.instances.Put(inst)
+}
+
+// checkOverlay returns an error when fn cannot replace the func name of the FuncMap, for a render
+func (c *compiled) checkOverlay(name string, fn any) error {
+	if _, found := c.funcs[name]; !found || strings.HasPrefix(name, "_") {
+		return fmt.Errorf("template: func %q is not in the FuncMap, only funcs of the FuncMap can be replaced", name)
+	}
+
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return fmt.Errorf("template: func %q is a %T, not a function", name, fn)
+	}
+
+	typ := v.Type()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	if n := typ.NumOut(); n < 1 || n > 2 || n == 2 && typ.Out(1) != errorType {
+		return fmt.Errorf("template: func %q must return a value, or a value and an error", name)
+	}
+
+	return nil
+}
+
+// callsCtx reports whether cmd calls ctx, or _step which reads it
+func callsCtx(cmd *parse.CommandNode) bool {
+	for _, arg := range cmd.Args {
+		if ident, ok := arg.(*parse.IdentifierNode); ok && (ident.Ident == "ctx" || ident.Ident == "_step") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// noStep is the _step builtin of renders without a context
+func noStep() bool {
+	return true
+}
+
+// backgroundCtx is the ctx builtin of templates rendered without a context
+func backgroundCtx() context.Context {
+	return context.Background()
+}
+
+// limitWriter fails writes once ctx is done, or once more than max bytes are written when max is set
+type limitWriter struct {
+	ctx context.Context
+	w   io.Writer
+	n   int
+	max int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if w.max > 0 && w.n+len(p) > w.max {
+		return 0, ErrOutputLimit
+	}
+
+	w.n += len(p)
+	return w.w.Write(p)
+}
+
+// RenderContext renders option to out like Render. once ctx is done nothing more is written,
+// and ctx.Err() is returned. templates reach ctx through the ctx builtin e.g. {{ t ctx "title" }}
+func (t *Template) RenderContext(ctx context.Context, out io.Writer, option RenderOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := t.load(ctx, nil, nil, &option); err != nil {
+		return err
+	}
+
+	return t.renderFiles(ctx, out, option)
+}
@@ -0,0 +1,290 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type userKey struct{}
+
+func contextTemplates(t *testing.T, cancel *context.CancelFunc) *Template {
+	mfs := fstest.MapFS{
+		"site/greet.tmpl":  {Data: []byte(`hi {{ user ctx }}`)},
+		"site/layout.tmpl": {Data: []byte(`<main>{{ block "content" . }}{{ end }}</main>`)},
+		"site/page.tmpl":   {Data: []byte(`{{/* extends "layout" */}}{{ define "content" }}{{ template "greet" . }}{{ end }}`)},
+		"site/list.tmpl":   {Data: []byte(`{{ range . }}{{ stopAt . 3 }}[{{ . }}]{{ end }}`)},
+		"site/card.tmpl":   {Data: []byte(`<Card>{{ user ctx }}</Card>`)},
+		"site/boxed.tmpl":  {Data: []byte(`<Card>x</Card>`)},
+
+		"site/components/badge.tmpl": {Data: []byte(`<b>{{ user ctx }}</b>`)},
+		"site/components/card.tmpl":  {Data: []byte(`<div><Badge />{{ .children }}</div>`)},
+	}
+	tpl, err := New("site", &TemplateOptions{FS: mfs, FuncMap: template.FuncMap{
+		"user": func(ctx context.Context) string {
+			user, _ := ctx.Value(userKey{}).(string)
+			return user
+		},
+		"stopAt": func(i, at int) string {
+			if i == at && *cancel != nil {
+				(*cancel)()
+			}
+			return ""
+		},
+	}})
+	require.NoError(t, err)
+
+	return tpl
+}
+
+func TestTemplate_RenderContext(t *testing.T) {
+	var cancel context.CancelFunc
+	tpl := contextTemplates(t, &cancel)
+
+	ctx := context.WithValue(context.Background(), userKey{}, "ayo")
+	out := new(bytes.Buffer)
+	require.NoError(t, tpl.RenderContext(ctx, out, RenderOption{Template: "page"}))
+	assert.Equal(t, "<main>hi ayo</main>", out.String())
+
+	// rendering without a context
+	out.Reset()
+	require.NoError(t, tpl.Render(out, RenderOption{Template: "page"}))
+	assert.Equal(t, "<main>hi </main>", out.String())
+
+	out.Reset()
+	require.NoError(t, tpl.RenderContext(ctx, out, RenderOption{Template: `{{ user ctx }}!`, RenderString: true}))
+	assert.Equal(t, "ayo!", out.String())
+
+	// components, and the components they use, are bound to the render
+	out.Reset()
+	require.NoError(t, tpl.RenderContext(ctx, out, RenderOption{Template: "card"}))
+	assert.Equal(t, "<div><b>ayo</b>ayo</div>", out.String())
+
+	out.Reset()
+	require.NoError(t, tpl.RenderContext(ctx, out, RenderOption{Template: "boxed"}))
+	assert.Equal(t, "<div><b>ayo</b>x</div>", out.String())
+}
+
+func TestCompiled_shared(t *testing.T) {
+	var cancel context.CancelFunc
+	tpl := contextTemplates(t, &cancel)
+	s := tpl.snapshot()
+
+	shared := func(ctx context.Context, option RenderOption) bool {
+		c, err := tpl.templateFor(s, option)
+		require.NoError(t, err)
+		inst, err := c.get(ctx, option.Funcs)
+		require.NoError(t, err)
+		defer c.put(inst)
+		return inst.shared
+	}
+
+	// renders share the cached template unless they bind funcs, or a ctx the template uses
+	ctx := context.WithValue(context.Background(), userKey{}, "ayo")
+	assert.True(t, shared(context.Background(), RenderOption{Template: "greet"}))
+	assert.True(t, shared(ctx, RenderOption{Template: "list"}))
+	assert.False(t, shared(ctx, RenderOption{Template: "greet"}))
+	// badge, used by card, calls ctx
+	assert.False(t, shared(ctx, RenderOption{Template: "boxed"}))
+	assert.False(t, shared(context.Background(), RenderOption{Template: "list", Funcs: template.FuncMap{"user": func(context.Context) string { return "" }}}))
+}
+
+func TestTemplate_RenderContext_cancel(t *testing.T) {
+	var cancel context.CancelFunc
+	tpl := contextTemplates(t, &cancel)
+
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	out := new(bytes.Buffer)
+	err := tpl.RenderContext(ctx, out, RenderOption{Template: "list", Data: []int{1, 2, 3, 4, 5}})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, "[1][2]", out.String())
+
+	// nothing is written when buffered
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	out.Reset()
+	err = tpl.RenderContext(ctx, out, RenderOption{Template: "list", Data: []int{1, 2, 3, 4, 5}, Buffered: true})
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, out.String())
+
+	// a done context renders nothing, nor loads data
+	tpl.Load("greet", func(ctx context.Context, r *http.Request, params map[string]string) (any, error) {
+		t.Fatal("loader called")
+		return nil, nil
+	})
+	err = tpl.RenderContext(ctx, out, RenderOption{Template: "greet"})
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, out.String())
+}
+
+func TestTemplate_RenderContext_concurrent(t *testing.T) {
+	var cancel context.CancelFunc
+	tpl := contextTemplates(t, &cancel)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			user := fmt.Sprint("user", i)
+			out := new(bytes.Buffer)
+			ctx := context.WithValue(context.Background(), userKey{}, user)
+			assert.NoError(t, tpl.RenderContext(ctx, out, RenderOption{Template: "page"}))
+			assert.Equal(t, "<main>hi "+user+"</main>", out.String())
+
+			out.Reset()
+			assert.NoError(t, tpl.RenderContext(ctx, out, RenderOption{Template: "card"}))
+			assert.Equal(t, "<div><b>"+user+"</b>"+user+"</div>", out.String())
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestTemplate_RenderOOBContext(t *testing.T) {
+	var cancel context.CancelFunc
+	tpl := contextTemplates(t, &cancel)
+
+	ctx := context.WithValue(context.Background(), userKey{}, "ayo")
+	out := new(bytes.Buffer)
+	require.NoError(t, tpl.RenderOOBContext(ctx, out, RenderOption{Template: "page"}, OOBSwap{Block: "content", Target: "c"}))
+	assert.Equal(t, `<main>hi ayo</main><div id="c" hx-swap-oob="true">hi ayo</div>`, out.String())
+
+	ctx, cancel = context.WithCancel(ctx)
+	cancel()
+	out.Reset()
+	err := tpl.RenderOOBContext(ctx, out, RenderOption{Template: "page"}, OOBSwap{Block: "content", Target: "c"})
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, out.String())
+}
+
+func TestTemplate_Respond_context(t *testing.T) {
+	var cancel context.CancelFunc
+	tpl := contextTemplates(t, &cancel)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), userKey{}, "ayo"))
+	w := httptest.NewRecorder()
+	require.NoError(t, tpl.Respond(w, r, http.StatusOK, RenderOption{Template: "greet"}))
+	assert.Equal(t, "hi ayo", w.Body.String())
+}
+
+func funcsTemplates(t testing.TB) *Template {
+	mfs := fstest.MapFS{
+		"site/layout.tmpl":            {Data: []byte(`<main>{{ block "content" . }}{{ end }}</main>`)},
+		"site/form.tmpl":              {Data: []byte(`{{/* extends "layout" */}}{{ define "content" }}<form><input value="{{ csrfToken }}">{{ template "user" . }}<Button /></form>{{ end }}`)},
+		"site/shared/user.tmpl":       {Data: []byte(`{{ define "user" }}{{ t "by" }} {{ currentUser }}{{ end }}`)},
+		"site/components/button.tmpl": {Data: []byte(`<button>{{ t "send" }}</button>`)},
+	}
+	tpl, err := New("site", &TemplateOptions{FS: mfs, FuncMap: template.FuncMap{
+		"csrfToken":   func() string { return "" },
+		"currentUser": func() string { return "guest" },
+		"t":           func(key string) string { return key },
+	}})
+	require.NoError(t, err)
+
+	return tpl
+}
+
+func TestRenderOption_Funcs(t *testing.T) {
+	tpl := funcsTemplates(t)
+
+	render := func(option RenderOption) (string, error) {
+		out := new(bytes.Buffer)
+		err := tpl.Render(out, option)
+		return out.String(), err
+	}
+
+	out, err := render(RenderOption{Template: "form", Funcs: template.FuncMap{
+		"csrfToken":   func() string { return "tok3n" },
+		"currentUser": func() (string, error) { return "ayo", nil },
+		"t":           func(key string) string { return map[string]string{"by": "par", "send": "envoyer"}[key] },
+	}})
+	require.NoError(t, err)
+	// components rendered by the template use the funcs of the render too
+	assert.Equal(t, `<main><form><input value="tok3n">par ayo<button>envoyer</button></form></main>`, out)
+
+	// funcs are bound to a single render
+	out, err = render(RenderOption{Template: "form"})
+	require.NoError(t, err)
+	assert.Equal(t, `<main><form><input value="">by guest<button>send</button></form></main>`, out)
+
+	out, err = render(RenderOption{Template: "{{ currentUser }}", RenderString: true, Funcs: template.FuncMap{
+		"currentUser": func() string { return "ayo" },
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "ayo", out)
+
+	for name, fn := range map[string]any{
+		"unknown":   func() string { return "" },
+		"_capture":  func() string { return "" },
+		"csrfToken": "tok3n",
+		"t":         func(key string) {},
+	} {
+		_, err = render(RenderOption{Template: "form", Funcs: template.FuncMap{name: fn}})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRenderOption_Funcs_concurrent(t *testing.T) {
+	tpl := funcsTemplates(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			token := fmt.Sprint("token", i)
+			out := new(bytes.Buffer)
+			err := tpl.Render(out, RenderOption{Template: "form", Funcs: template.FuncMap{
+				"csrfToken": func() string { return token },
+				"t":         func(key string) string { return key + "-" + token },
+			}})
+			assert.NoError(t, err)
+			assert.Equal(t, `<main><form><input value="`+token+`">by-`+token+` guest<button>send-`+token+`</button></form></main>`, out.String())
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkRenderOption_Funcs(b *testing.B) {
+	funcs := template.FuncMap{
+		"csrfToken":   func() string { return "tok3n" },
+		"currentUser": func() string { return "ayo" },
+	}
+
+	run := func(b *testing.B, tpl *Template, option RenderOption) {
+		out := new(bytes.Buffer)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			out.Reset()
+			if err := tpl.Render(out, option); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("none", func(b *testing.B) {
+		run(b, funcsTemplates(b), RenderOption{Template: "form"})
+	})
+	b.Run("overlay", func(b *testing.B) {
+		run(b, funcsTemplates(b), RenderOption{Template: "form", Funcs: funcs})
+	})
+	b.Run("parse", func(b *testing.B) {
+		tpl := funcsTemplates(b)
+		tpl.Debug = true
+		run(b, tpl, RenderOption{Template: "form", Funcs: funcs})
+	})
+}
@@ -0,0 +1,399 @@
+package templates
+
+import (
+	"context"
+	"html/template"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template/parse"
+)
+
+// depGraph records the files each cache entry was built from and the reverse
+type depGraph struct {
+	keyFiles  map[cacheKey][]string
+	fileKeys  map[string]map[cacheKey]bool
+	keyOption map[cacheKey]RenderOption
+}
+
+func newDepGraph() *depGraph {
+	return &depGraph{
+		keyFiles:  make(map[cacheKey][]string),
+		fileKeys:  make(map[string]map[cacheKey]bool),
+		keyOption: make(map[cacheKey]RenderOption),
+	}
+}
+
+func (g *depGraph) add(key cacheKey, option RenderOption, files []string) {
+	g.remove(key)
+
+	g.keyFiles[key] = files
+	g.keyOption[key] = option
+	for _, file := range files {
+		if g.fileKeys[file] == nil {
+			g.fileKeys[file] = make(map[cacheKey]bool)
+		}
+		g.fileKeys[file][key] = true
+	}
+}
+
+func (g *depGraph) remove(key cacheKey) {
+	for _, file := range g.keyFiles[key] {
+		delete(g.fileKeys[file], key)
+		if len(g.fileKeys[file]) == 0 {
+			delete(g.fileKeys, file)
+		}
+	}
+
+	delete(g.keyFiles, key)
+	delete(g.keyOption, key)
+}
+
+// keys returns the cache keys built from file, sorted
+func (g *depGraph) keys(file string) []cacheKey {
+	var keys []cacheKey
+	for key := range g.fileKeys[file] {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, cacheKey.compare)
+
+	return keys
+}
+
+// Dependents returns the render options of every cached template built from file.
+// file can be relative to the template root, with or without the template extension
+// e.g. "shared/modal/overlay" or "components/card.tmpl"
+func (t *Template) Dependents(file string) []RenderOption {
+	s := t.snapshot()
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var options []RenderOption
+	for _, key := range s.deps.keys(t.absTemplateName(file)) {
+		options = append(options, s.deps.keyOption[key])
+	}
+
+	return options
+}
+
+// Dependencies returns the files the cached template for option was built from,
+// including its layouts, referenced templates, shared templates and components
+func (t *Template) Dependencies(option RenderOption) []string {
+	s := t.snapshot()
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return slices.Clone(s.deps.keyFiles[keyOf(option)])
+}
+
+// Invalidate evicts every cache entry built from file. invalidating a component parses the components
+// again and swaps them into the current snapshot. shared templates are part of the snapshot templates
+// are parsed against, so invalidating one of them builds a new snapshot
+func (t *Template) Invalidate(file string) error {
+	file = t.absTemplateName(file)
+	if strings.HasPrefix(file, t.sharedFolder+string(filepath.Separator)) {
+		return t.reload(context.Background(), false)
+	}
+
+	s := t.snapshot()
+	if strings.HasPrefix(file, filepath.Join(t.root, t.componentFolder)+string(filepath.Separator)) {
+		t.reloadMtx.Lock()
+		defer t.reloadMtx.Unlock()
+
+		components, err := t.newComponentSet(s)
+		if err != nil {
+			return err
+		}
+		s.components.Store(components)
+	}
+
+	s.mtx.Lock()
+	keys := s.deps.keys(file)
+	for _, key := range keys {
+		delete(s.cache, key)
+		s.deps.remove(key)
+	}
+	s.mtx.Unlock()
+
+	for _, key := range keys {
+		if s.strings.remove(key) {
+			s.sources.delete(key.name)
+		}
+	}
+
+	return nil
+}
+
+// templateDeps returns files plus the shared templates reachable from tpl and the files
+// of every component in s used by tpl
+func (t *Template) templateDeps(s *snapshot, tpl *template.Template, files []string) []string {
+	deps := append(slices.Clone(files), s.sharedDeps(tpl)...)
+	components := s.components.Load()
+	seen := map[string]bool{}
+	pending := componentCalls(tpl)
+	for len(pending) > 0 {
+		var name string
+		name, pending = pending[0], pending[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		deps = append(deps, filepath.Join(t.root, t.componentFolder, name+t.ext))
+		if components != nil {
+			pending = append(pending, components.refs[name]...)
+		}
+	}
+
+	return deps
+}
+
+// sharedDeps returns the shared files defining the templates reachable from the templates of tpl
+// that are parsed from other files, in the order of s.sharedFiles
+func (s *snapshot) sharedDeps(tpl *template.Template) []string {
+	if len(s.sharedFiles) == 0 {
+		return nil
+	}
+
+	sharedNames := make(map[string]bool, len(s.shared))
+	for _, src := range s.shared {
+		sharedNames[src.name] = true
+	}
+
+	var pending []string
+	for _, tmpl := range tpl.Templates() {
+		if tmpl.Tree != nil && !sharedNames[tmpl.Tree.ParseName] {
+			pending = append(pending, tmpl.Name())
+		}
+	}
+
+	used := map[string]bool{}
+	seen := map[string]bool{}
+	for len(pending) > 0 {
+		var name string
+		name, pending = pending[0], pending[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		tmpl := tpl.Lookup(name)
+		if tmpl == nil || tmpl.Tree == nil {
+			continue
+		}
+		if sharedNames[tmpl.Tree.ParseName] {
+			used[tmpl.Tree.ParseName] = true
+		}
+		walkCalls(tmpl.Tree.Root, func(callee string, component bool) {
+			if !component {
+				pending = append(pending, callee)
+			}
+		})
+	}
+
+	var deps []string
+	for _, file := range s.sharedFiles {
+		if used[s.shared[file].name] {
+			deps = append(deps, file)
+		}
+	}
+
+	return deps
+}
+
+// componentRefsOf maps each component in tpl to the components it uses, including those
+// used in the blocks captured from between its component tags
+func componentRefsOf(tpl *template.Template, ext string) map[string][]string {
+	refs := make(map[string][]string)
+	for _, tmpl := range tpl.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+
+		name := strings.TrimSuffix(tmpl.Tree.ParseName, ext)
+		refs[name] = treeComponentCalls(tmpl.Tree, refs[name])
+	}
+
+	return refs
+}
+
+// ctxComponents lists the components in tpl that call ctx, directly or through the components in refs
+func ctxComponents(tpl *template.Template, refs map[string][]string, ext string) map[string]bool {
+	ctx := make(map[string]bool)
+	for _, tmpl := range tpl.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+
+		name := strings.TrimSuffix(tmpl.Tree.ParseName, ext)
+		walkNodes(tmpl.Tree.Root, func(cmd *parse.CommandNode) {
+			ctx[name] = ctx[name] || callsCtx(cmd)
+		})
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for name, used := range refs {
+			if !ctx[name] && slices.ContainsFunc(used, func(u string) bool { return ctx[u] }) {
+				ctx[name], changed = true, true
+			}
+		}
+	}
+
+	for name, used := range ctx {
+		if !used {
+			delete(ctx, name)
+		}
+	}
+
+	return ctx
+}
+
+// componentCalls lists the components invoked with a literal name, i.e {{ component "card" ... }}
+func componentCalls(tpl *template.Template) []string {
+	var names []string
+	for _, tmpl := range tpl.Templates() {
+		if tmpl.Tree != nil {
+			names = treeComponentCalls(tmpl.Tree, names)
+		}
+	}
+
+	return names
+}
+
+func treeComponentCalls(tree *parse.Tree, names []string) []string {
+	walkNodes(tree.Root, func(cmd *parse.CommandNode) {
+		if name, ok := componentName(cmd); ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	})
+
+	return names
+}
+
+// componentName returns the name of the component cmd invokes, when it is a literal
+func componentName(cmd *parse.CommandNode) (string, bool) {
+	if len(cmd.Args) < 2 {
+		return "", false
+	}
+
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok || ident.Ident != "component" {
+		return "", false
+	}
+
+	str, ok := cmd.Args[1].(*parse.StringNode)
+	if !ok {
+		return "", false
+	}
+
+	return str.Text, true
+}
+
+// legacyComponents lists the components that branch on ._isEnd to render their opening and closing tags
+func legacyComponents(tpl *template.Template) map[string]bool {
+	legacy := make(map[string]bool)
+	for _, tmpl := range tpl.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+
+		walkNodes(tmpl.Tree.Root, func(cmd *parse.CommandNode) {
+			for _, arg := range cmd.Args {
+				if field, ok := arg.(*parse.FieldNode); ok && slices.Equal(field.Ident, []string{"_isEnd"}) {
+					legacy[tmpl.Name()] = true
+				}
+			}
+		})
+	}
+
+	return legacy
+}
+
+// walkNodes calls fn for every command in the tree rooted at node
+func walkNodes(node parse.Node, fn func(cmd *parse.CommandNode)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkNodes(child, fn)
+		}
+	case *parse.ActionNode:
+		walkNodes(n.Pipe, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkNodes(cmd, fn)
+		}
+	case *parse.CommandNode:
+		fn(n)
+		for _, arg := range n.Args {
+			walkNodes(arg, fn)
+		}
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.ChainNode:
+		walkNodes(n.Node, fn)
+	case *parse.TemplateNode:
+		walkNodes(n.Pipe, fn)
+	}
+}
+
+// walkCalls calls fn with the templates and blocks invoked in the tree rooted at node, and the
+// components it uses
+func walkCalls(node parse.Node, fn func(name string, component bool)) {
+	walkTemplates(node, func(n *parse.TemplateNode) {
+		fn(n.Name, false)
+	})
+	walkNodes(node, func(cmd *parse.CommandNode) {
+		if name, ok := componentName(cmd); ok {
+			fn(name, true)
+		}
+		if len(cmd.Args) < 2 {
+			return
+		}
+		if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "_capture" {
+			if str, ok := cmd.Args[1].(*parse.StringNode); ok {
+				fn(str.Text, false)
+			}
+		}
+	})
+}
+
+// walkTemplates calls fn for every template action in the tree rooted at node
+func walkTemplates(node parse.Node, fn func(n *parse.TemplateNode)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplates(child, fn)
+		}
+	case *parse.IfNode:
+		walkTemplates(n.List, fn)
+		walkTemplates(n.ElseList, fn)
+	case *parse.RangeNode:
+		walkTemplates(n.List, fn)
+		walkTemplates(n.ElseList, fn)
+	case *parse.WithNode:
+		walkTemplates(n.List, fn)
+		walkTemplates(n.ElseList, fn)
+	case *parse.TemplateNode:
+		fn(n)
+	}
+}
+
+func walkBranch(n *parse.BranchNode, fn func(cmd *parse.CommandNode)) {
+	walkNodes(n.Pipe, fn)
+	walkNodes(n.List, fn)
+	walkNodes(n.ElseList, fn)
+}
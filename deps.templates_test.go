@@ -0,0 +1,86 @@
+package templates
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Dependencies(t *testing.T) {
+	tpl, err := New("./testData", options)
+	require.NoError(t, err)
+
+	d := struct{ Name string }{Name: "philippta"}
+	for _, name := range []string{"profile", "child", "comp-dialog", "solo"} {
+		require.NoError(t, tpl.Render(bytes.NewBuffer(nil), RenderOption{Template: name, Data: d}))
+	}
+
+	assert.Equal(t, []string{
+		"testData/grandpa.tmpl",
+		"testData/dad.tmpl",
+		"testData/child.tmpl",
+	}, tpl.Dependencies(RenderOption{Template: "child"}))
+
+	assert.Equal(t, []RenderOption{{Template: "profile"}}, tpl.Dependents("cast"))
+	// the content block of profile is replaced by the one shared/user defines,
+	// so the overlay it calls is never reached
+	assert.Equal(t, []RenderOption{{Template: "profile"}}, tpl.Dependents("shared/user"))
+	assert.Empty(t, tpl.Dependents("shared/modal/overlay.tmpl"))
+
+	// box is used by the dialog component
+	assert.Equal(t, []RenderOption{{Template: "comp-dialog"}}, tpl.Dependents("components/box"))
+	assert.Contains(t, tpl.Dependencies(RenderOption{Template: "comp-dialog"}), "testData/components/card.tmpl")
+
+	require.NoError(t, tpl.Invalidate("dad"))
+	assert.False(t, tpl.InCache("", "child"))
+	assert.True(t, tpl.InCache("", "profile"))
+	assert.Empty(t, tpl.Dependents("dad"))
+
+	require.NoError(t, tpl.Invalidate("shared/widgets"))
+	assert.False(t, tpl.InCache("", "profile"))
+	assert.False(t, tpl.InCache("", "solo"))
+}
+
+func TestTemplate_Dependencies_captured(t *testing.T) {
+	mfs := fstest.MapFS{
+		"site/page.tmpl":             {Data: []byte(`<Card>x</Card>`)},
+		"site/components/card.tmpl":  {Data: []byte(`<Wrap><Badge /></Wrap>`)},
+		"site/components/wrap.tmpl":  {Data: []byte(`{{ .children }}`)},
+		"site/components/badge.tmpl": {Data: []byte(`b`)},
+	}
+	tpl, err := New("site", &TemplateOptions{FS: mfs})
+	require.NoError(t, err)
+
+	require.NoError(t, tpl.Render(bytes.NewBuffer(nil), RenderOption{Template: "page"}))
+	// badge is used between the wrap tags of card
+	assert.Equal(t, []RenderOption{{Template: "page"}}, tpl.Dependents("components/badge"))
+}
+
+func TestTemplate_Invalidate_component(t *testing.T) {
+	root := copyTestData(t)
+	tpl, err := New(root, options)
+	require.NoError(t, err)
+
+	d := struct{ Name string }{Name: "philippta"}
+	for _, name := range []string{"profile", "comp-dialog"} {
+		require.NoError(t, tpl.Render(bytes.NewBuffer(nil), RenderOption{Template: name, Data: d}))
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "components", "box.tmpl"), []byte(`<div class="newBox">{{ .children }}</div>`), 0o644))
+	s := tpl.snapshot()
+	require.NoError(t, tpl.Invalidate("components/box"))
+
+	// only the templates using the component are evicted, from the same snapshot
+	assert.Same(t, s, tpl.snapshot())
+	assert.True(t, tpl.InCache("", "profile"))
+	assert.False(t, tpl.InCache("", "comp-dialog"))
+
+	buff := bytes.NewBuffer(nil)
+	require.NoError(t, tpl.Render(buff, RenderOption{Template: "comp-dialog", Data: d}))
+	assert.Contains(t, buff.String(), `class="newBox"`)
+}
@@ -0,0 +1,115 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/mayowa/templates/scanner"
+)
+
+// TemplateNotFoundError is returned when a template to be rendered does not exist
+type TemplateNotFoundError struct {
+	Name          string
+	SearchedPaths []string
+}
+
+func (e *TemplateNotFoundError) Error() string {
+	return fmt.Sprintf("template: %q not found, searched %s", e.Name, strings.Join(e.SearchedPaths, ", "))
+}
+
+// Is makes TemplateNotFoundError match fs.ErrNotExist
+func (e *TemplateNotFoundError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
+
+// LayoutNotFoundError is returned when the layout a template is rendered in, or extends, does not exist
+type LayoutNotFoundError struct {
+	Template string
+	Layout   string
+}
+
+func (e *LayoutNotFoundError) Error() string {
+	if e.Template == "" {
+		return fmt.Sprintf("template: layout %q not found", e.Layout)
+	}
+
+	return fmt.Sprintf("template: layout %q of %q not found", e.Layout, e.Template)
+}
+
+// Is makes LayoutNotFoundError match ErrLayoutNotFound
+func (e *LayoutNotFoundError) Is(target error) bool {
+	return target == ErrLayoutNotFound
+}
+
+// ComponentError is an error in the use of a component tag, on Line of File
+type ComponentError struct {
+	Component string
+	File      string
+	Line      int
+	Err       error
+}
+
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("template: %scomponent %s: %v", location(e.File, e.Line), e.Component, e.Err)
+}
+
+func (e *ComponentError) Unwrap() error {
+	return e.Err
+}
+
+// UnclosedTagError is returned when the tag of a component is not closed
+type UnclosedTagError struct {
+	Tag  string
+	File string
+	Line int
+}
+
+func (e *UnclosedTagError) Error() string {
+	return fmt.Sprintf("template: %sunclosed tag <%s", location(e.File, e.Line), e.Tag)
+}
+
+// location formats file and line as the prefix of an error message
+func location(file string, line int) string {
+	switch {
+	case file == "" && line == 0:
+		return ""
+	case file == "":
+		return "line " + strconv.Itoa(line) + ": "
+	case line == 0:
+		return file + ": "
+	}
+
+	return file + ":" + strconv.Itoa(line) + ": "
+}
+
+// tagError converts an error returned while reading the tags of a template into a *ComponentError
+// or *UnclosedTagError
+func tagError(err error) error {
+	var tErr *scanner.TagError
+	if !errors.As(err, &tErr) {
+		return err
+	}
+
+	if errors.Is(err, scanner.ErrUnterminatedTag) {
+		return &UnclosedTagError{Tag: tErr.Name, Line: tErr.Line + 1}
+	}
+
+	return &ComponentError{Component: tErr.Name, Line: tErr.Line + 1, Err: tErr.Err}
+}
+
+// withFile sets the file of component errors to file
+func withFile(err error, file string) error {
+	var cErr *ComponentError
+	var uErr *UnclosedTagError
+	switch {
+	case errors.As(err, &cErr):
+		cErr.File = file
+	case errors.As(err, &uErr):
+		uErr.File = file
+	}
+
+	return err
+}
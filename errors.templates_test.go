@@ -0,0 +1,53 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorTypes(t *testing.T) {
+	tpl := newMapFSTemplate(t, map[string]string{
+		"orphan.tmpl":   `{{/* extends "missing" */}}orphan`,
+		"stray.tmpl":    "<p>\n</Card>\n</p>",
+		"unclosed.tmpl": "<p>\n\n<Card title=\"x\"\n",
+	})
+
+	render := func(option RenderOption) error {
+		return tpl.Render(bytes.NewBuffer(nil), option)
+	}
+
+	err := render(RenderOption{Template: "nope"})
+	var nfErr *TemplateNotFoundError
+	require.True(t, errors.As(err, &nfErr))
+	assert.Equal(t, "nope", nfErr.Name)
+	assert.Equal(t, []string{"testData/nope.tmpl"}, nfErr.SearchedPaths)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	var lErr *LayoutNotFoundError
+	err = render(RenderOption{Layout: "missing", Template: "solo"})
+	require.True(t, errors.As(err, &lErr))
+	assert.Equal(t, LayoutNotFoundError{Template: "solo", Layout: "missing"}, *lErr)
+	assert.ErrorIs(t, err, ErrLayoutNotFound)
+
+	err = render(RenderOption{Template: "orphan"})
+	require.True(t, errors.As(err, &lErr))
+	assert.Equal(t, LayoutNotFoundError{Template: "orphan", Layout: "missing"}, *lErr)
+
+	err = render(RenderOption{Template: "stray"})
+	var cErr *ComponentError
+	require.True(t, errors.As(err, &cErr))
+	assert.Equal(t, "Card", cErr.Component)
+	assert.Equal(t, "testData/stray.tmpl", cErr.File)
+	assert.Equal(t, 2, cErr.Line)
+
+	err = render(RenderOption{Template: "unclosed"})
+	var uErr *UnclosedTagError
+	require.True(t, errors.As(err, &uErr))
+	assert.Equal(t, UnclosedTagError{Tag: "Card", File: "testData/unclosed.tmpl", Line: 3}, *uErr)
+	assert.EqualError(t, err, "template: testData/unclosed.tmpl:3: unclosed tag <Card")
+}
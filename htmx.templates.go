@@ -0,0 +1,93 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// OOBSwap is an extra block rendered for an htmx out of band swap
+type OOBSwap struct {
+	// Block is the name of the block or defined template to render
+	Block string
+	// Target is the id of the element the block is swapped into
+	Target string
+	// Swap is the hx-swap-oob value, defaults to "true"
+	Swap string
+}
+
+// RenderOOB renders option (or option.Fragment when set) followed by each swap block, wrapped in
+// an element with the swap's target id and hx-swap-oob attribute. every block is executed
+// with option.Data from the same template set
+func (t *Template) RenderOOB(out io.Writer, option RenderOption, swaps ...OOBSwap) error {
+	return t.RenderOOBContext(context.Background(), out, option, swaps...)
+}
+
+// RenderOOBContext renders option and swaps like RenderOOB, bound to ctx like RenderContext
+func (t *Template) RenderOOBContext(ctx context.Context, out io.Writer, option RenderOption, swaps ...OOBSwap) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := t.load(ctx, nil, nil, &option); err != nil {
+		return err
+	}
+
+	if !option.Buffered {
+		return t.renderOOB(ctx, out, option, swaps)
+	}
+
+	buff := getBuffer()
+	defer putBuffer(buff)
+	if err := t.renderOOB(ctx, buff, option, swaps); err != nil {
+		return err
+	}
+
+	_, err := buff.WriteTo(out)
+	return err
+}
+
+func (t *Template) renderOOB(ctx context.Context, out io.Writer, option RenderOption, swaps []OOBSwap) error {
+	s := t.snapshot()
+	c, err := t.templateFor(s, option)
+	if err != nil {
+		return err
+	}
+
+	inst, err := c.get(ctx, option.Funcs)
+	if err != nil {
+		return err
+	}
+	defer c.put(inst)
+
+	tpl := inst.tpl
+	if err = execute(ctx, tpl, out, option); err != nil {
+		return s.sources.rewrite(err)
+	}
+
+	for _, swap := range swaps {
+		if swap.Swap == "" {
+			swap.Swap = "true"
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, `<div id="%s" hx-swap-oob="%s">`,
+			template.HTMLEscapeString(swap.Target), template.HTMLEscapeString(swap.Swap))
+		if err != nil {
+			return err
+		}
+
+		if err = execute(ctx, tpl, out, RenderOption{Fragment: swap.Block, Data: option.Data}); err != nil {
+			return s.sources.rewrite(err)
+		}
+
+		if _, err = io.WriteString(out, "</div>"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package templates
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_RenderOOB(t *testing.T) {
+	tpl, err := New("./testData", options)
+	require.NoError(t, err)
+
+	buff := bytes.NewBuffer(nil)
+	d := struct{ Name string }{Name: "philippta"}
+	err = tpl.RenderOOB(buff, RenderOption{Template: "profile", Fragment: "user_content", Data: d},
+		OOBSwap{Block: "widgets", Target: "widgets"},
+		OOBSwap{Block: "modal/overlay", Target: `modal"`, Swap: "innerHTML"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t,
+		"\n  A username: philippta\n  "+
+			`<div id="widgets" hx-swap-oob="true">Hey!</div>`+
+			`<div id="modal&#34;" hx-swap-oob="innerHTML">You cant see me!</div>`,
+		buff.String())
+	assert.True(t, tpl.InCache("", "profile"))
+
+	err = tpl.RenderOOB(buff, RenderOption{Template: "profile", Data: d}, OOBSwap{Block: "missing", Target: "missing"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strconv"
+)
+
+// ErrorData is the data the 404 and 500 error pages are rendered with
+type ErrorData struct {
+	Status  int
+	Err     error
+	Request *http.Request
+}
+
+// Handler returns a handler that renders opts, with the data dataFn returns for the request when
+// dataFn is set, or the data of the loader of opts.Template otherwise. see Respond
+func (t *Template) Handler(opts RenderOption, dataFn func(*http.Request) (any, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		option := opts
+		if dataFn != nil {
+			data, err := dataFn(r)
+			if err != nil {
+				t.respondError(w, r, err)
+				return
+			}
+			option.Data = data
+		}
+
+		_ = t.Respond(w, r, http.StatusOK, option)
+	})
+}
+
+// Respond renders opts into a buffer and writes it with status. when opts.Data is nil the data is
+// loaded by the loader of opts.Template. when loading or rendering fails nothing of the page is
+// written, the 404 template (missing templates, or loader errors matching fs.ErrNotExist) or the 500
+// template (any other error) from the root is rendered instead, falling back to a plain text response
+// when there is none. the error is returned
+func (t *Template) Respond(w http.ResponseWriter, r *http.Request, status int, opts RenderOption) error {
+	return t.respond(w, r, status, opts, nil)
+}
+
+// respond is Respond for a page routed with params, which are the data of pages without a loader
+func (t *Template) respond(w http.ResponseWriter, r *http.Request, status int, opts RenderOption, params map[string]string) error {
+	err := t.load(r.Context(), r, params, &opts)
+	if err != nil {
+		t.respondError(w, r, err)
+		return err
+	}
+	if opts.Data == nil && params != nil {
+		opts.Data = params
+	}
+
+	buff := getBuffer()
+	defer putBuffer(buff)
+
+	opts.Buffered = false
+	if err = t.renderFiles(r.Context(), buff, opts); err != nil {
+		t.respondError(w, r, err)
+		return err
+	}
+
+	writeHTML(w, status, buff)
+	return nil
+}
+
+// respondError writes the error page for err
+func (t *Template) respondError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, fs.ErrNotExist) {
+		status = http.StatusNotFound
+	}
+
+	buff := getBuffer()
+	defer putBuffer(buff)
+
+	name := strconv.Itoa(status)
+	if t.pathExists(t.absTemplateName(name)) {
+		data := ErrorData{Status: status, Err: err, Request: r}
+		if t.Render(buff, RenderOption{Template: name, Data: data}) == nil {
+			writeHTML(w, status, buff)
+			return
+		}
+	}
+
+	http.Error(w, http.StatusText(status), status)
+}
+
+func writeHTML(w http.ResponseWriter, status int, buff *bytes.Buffer) {
+	h := w.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "text/html; charset=utf-8")
+	}
+	h.Set("Content-Length", strconv.Itoa(buff.Len()))
+
+	w.WriteHeader(status)
+	_, _ = buff.WriteTo(w)
+}
@@ -0,0 +1,70 @@
+package templates
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Handler(t *testing.T) {
+	tpl := newMapFSTemplate(t, map[string]string{
+		"half.tmpl": `<p>first half</p>{{ index .List 5 }}`,
+		"500.tmpl":  `<h1>{{ .Status }} while rendering {{ .Request.URL.Path }}</h1>`,
+	})
+
+	serve := func(h http.Handler) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+		return w
+	}
+
+	name := func(r *http.Request) (any, error) {
+		return map[string]any{"Name": "philippta", "List": []int{1}}, nil
+	}
+
+	w := serve(tpl.Handler(RenderOption{Template: "solo"}, name))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "philippta, This is solo act!", w.Body.String())
+
+	// nothing of a failed render is sent
+	w = serve(tpl.Handler(RenderOption{Template: "half"}, name))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "<h1>500 while rendering /page</h1>", w.Body.String())
+
+	w = serve(tpl.Handler(RenderOption{Template: "solo"}, func(r *http.Request) (any, error) {
+		return nil, errors.New("no database")
+	}))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "<h1>500 while rendering /page</h1>", w.Body.String())
+
+	// there is no 404 template
+	w = serve(tpl.Handler(RenderOption{Template: "nope"}, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "Not Found\n", w.Body.String())
+}
+
+func TestTemplate_Respond(t *testing.T) {
+	tpl := newMapFSTemplate(t, map[string]string{
+		"404.tmpl": `missing: {{ .Request.URL.Path }}`,
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/created", nil)
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/xhtml+xml")
+	require.NoError(t, tpl.Respond(w, r, http.StatusCreated, RenderOption{Template: "solo", Data: map[string]string{"Name": "ayo"}}))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "application/xhtml+xml", w.Header().Get("Content-Type"))
+	assert.Equal(t, "22", w.Header().Get("Content-Length"))
+
+	w = httptest.NewRecorder()
+	err := tpl.Respond(w, r, http.StatusOK, RenderOption{Template: "nope"})
+	var nfErr *TemplateNotFoundError
+	assert.True(t, errors.As(err, &nfErr))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "missing: /created", w.Body.String())
+}
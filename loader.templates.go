@@ -0,0 +1,69 @@
+package templates
+
+import (
+	"context"
+	"net/http"
+)
+
+// Loader loads the data a template is rendered with. r and params are nil when the template
+// is rendered outside of a request, params holds the dynamic route segments when routed by a Router
+type Loader func(ctx context.Context, r *http.Request, params map[string]string) (any, error)
+
+// LoaderError is returned when the loader of Template fails
+type LoaderError struct {
+	Template string
+	Err      error
+}
+
+func (e *LoaderError) Error() string {
+	return "template: loading data for " + e.Template + ": " + e.Err.Error()
+}
+
+func (e *LoaderError) Unwrap() error {
+	return e.Err
+}
+
+// Load registers loader for the template name. when a template is rendered without data
+// its loader is called for the data. registering nil removes the loader of name
+func (t *Template) Load(name string, loader Loader) {
+	t.loadersMtx.Lock()
+	defer t.loadersMtx.Unlock()
+
+	if loader == nil {
+		delete(t.loaders, name)
+		return
+	}
+	if t.loaders == nil {
+		t.loaders = make(map[string]Loader)
+	}
+	t.loaders[name] = loader
+}
+
+// Loader returns the loader registered for the template name, or nil
+func (t *Template) Loader(name string) Loader {
+	t.loadersMtx.RLock()
+	defer t.loadersMtx.RUnlock()
+
+	return t.loaders[name]
+}
+
+// load sets the data of option from the loader of its template, when it has no data.
+// templates rendered from source have no loader
+func (t *Template) load(ctx context.Context, r *http.Request, params map[string]string, option *RenderOption) error {
+	if option.Data != nil || option.RenderString {
+		return nil
+	}
+
+	loader := t.Loader(option.Template)
+	if loader == nil {
+		return nil
+	}
+
+	data, err := loader(ctx, r, params)
+	if err != nil {
+		return &LoaderError{Template: option.Template, Err: err}
+	}
+
+	option.Data = data
+	return nil
+}
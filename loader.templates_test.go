@@ -0,0 +1,112 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Load(t *testing.T) {
+	tpl, err := New("./testData", options)
+	require.NoError(t, err)
+
+	calls := 0
+	tpl.Load("solo", func(ctx context.Context, r *http.Request, params map[string]string) (any, error) {
+		calls++
+		assert.Nil(t, r)
+		assert.Nil(t, params)
+		return map[string]any{"Name": "loaded"}, nil
+	})
+
+	out := new(bytes.Buffer)
+	require.NoError(t, tpl.Render(out, RenderOption{Template: "solo"}))
+	assert.Equal(t, "loaded, This is solo act!", out.String())
+	assert.Equal(t, 1, calls)
+
+	// the data given is used over the loader
+	out.Reset()
+	require.NoError(t, tpl.Render(out, RenderOption{Template: "solo", Data: map[string]any{"Name": "given"}}))
+	assert.Equal(t, "given, This is solo act!", out.String())
+	assert.Equal(t, 1, calls)
+
+	// loader errors are told apart from template errors
+	errDB := errors.New("no database")
+	tpl.Load("solo", func(ctx context.Context, r *http.Request, params map[string]string) (any, error) {
+		return nil, errDB
+	})
+	err = tpl.Render(new(bytes.Buffer), RenderOption{Template: "solo"})
+	var lErr *LoaderError
+	require.ErrorAs(t, err, &lErr)
+	assert.Equal(t, "solo", lErr.Template)
+	assert.ErrorIs(t, err, errDB)
+	assert.EqualError(t, err, "template: loading data for solo: no database")
+
+	err = tpl.Render(new(bytes.Buffer), RenderOption{Template: "nope"})
+	assert.False(t, errors.As(err, &lErr))
+
+	tpl.Load("solo", nil)
+	assert.Nil(t, tpl.Loader("solo"))
+}
+
+func TestTemplate_Loader(t *testing.T) {
+	tpl, err := New("./testData", options)
+	require.NoError(t, err)
+
+	tpl.Load("veggies/[id]", func(ctx context.Context, r *http.Request, params map[string]string) (any, error) {
+		return r.URL.Query().Get("size") + " " + params["id"], nil
+	})
+
+	// loaders are called without a server
+	r := httptest.NewRequest(http.MethodGet, "/veggies/kale?size=large", nil)
+	data, err := tpl.Loader("veggies/[id]")(r.Context(), r, map[string]string{"id": "kale"})
+	require.NoError(t, err)
+	assert.Equal(t, "large kale", data)
+}
+
+func TestRouter_loader(t *testing.T) {
+	mfs := fstest.MapFS{
+		"site/404.tmpl":          {Data: []byte(`not found: {{ .Err }}`)},
+		"site/about.tmpl":        {Data: []byte(`about {{ .id }}`)},
+		"site/veggies/[id].tmpl": {Data: []byte(`{{ .Name }} from {{ .Path }}`)},
+	}
+
+	tpl, err := New("site", &TemplateOptions{FS: mfs})
+	require.NoError(t, err)
+
+	tpl.Load("veggies/[id]", func(ctx context.Context, r *http.Request, params map[string]string) (any, error) {
+		if params["id"] == "kale" {
+			return nil, fs.ErrNotExist
+		}
+		return map[string]any{"Name": params["id"], "Path": r.URL.Path}, nil
+	})
+
+	router, err := tpl.Router(RenderOption{})
+	require.NoError(t, err)
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := get("/veggies/carrots")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "carrots from /veggies/carrots", body)
+
+	// pages without a loader get the params
+	code, body = get("/about")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "about ", body)
+
+	code, body = get("/veggies/kale")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "not found: template: loading data for veggies/[id]: file does not exist", body)
+}
@@ -2,23 +2,20 @@ package templates
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
-	"os"
 	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
 )
 
-func (t *Template) parseFiles(tpl *template.Template, readFile readFileFunc, filenames ...string) (*template.Template, error) {
-	return parseFiles(tpl, readFile, t.FuncMap, filenames)
-}
-
 // parseFiles (adapted from stdlib)
-func parseFiles(tpl *template.Template, readFile readFileFunc, funcMap template.FuncMap, filenames []string) (*template.Template, error) {
+// the source map of every file is stored in sources, and parse errors are reported against the files
+func parseFiles(tpl *template.Template, readFile readFileFunc, funcMap template.FuncMap, sources *sourceMaps, filenames []string) (*template.Template, error) {
 	if len(filenames) == 0 {
 		// Not really a problem, but be consistent.
 		return nil, fmt.Errorf("html/template: no files named in call to ParseFiles")
@@ -29,11 +26,14 @@ func parseFiles(tpl *template.Template, readFile readFileFunc, funcMap template.
 			return nil, err
 		}
 
-		if err := processComponents(&b); err != nil {
-			return nil, fmt.Errorf("error processing component %s : %w", name, err)
+		out, spans, err := rewriteComponents(name, b)
+		if err != nil {
+			return nil, withFile(err, filename)
 		}
+		sm := newSourceMap(filename, b, out, spans)
+		sources.set(name, sm)
 
-		s := string(b)
+		s := string(out)
 		// First template becomes return value if not already defined,
 		// and we use that one for subsequent New calls to associate
 		// all the templates together. Also, if this file has the same name
@@ -53,84 +53,126 @@ func parseFiles(tpl *template.Template, readFile readFileFunc, funcMap template.
 		}
 		_, err = tmpl.Parse(s)
 		if err != nil {
-			return nil, err
+			return nil, rewriteError(err, func(string) *sourceMap { return sm })
 		}
 	}
+
+	// blocks captured from between component tags are rendered from this template set
+	tpl.Funcs(template.FuncMap{"_capture": captureFunc(tpl)})
 	return tpl, nil
 }
 
+// captureFunc returns the _capture builtin for the template set tpl belongs to,
+// it renders the named template and returns the output
+func captureFunc(tpl *template.Template) func(name string, data any) (template.HTML, error) {
+	return func(name string, data any) (template.HTML, error) {
+		buff := bytes.NewBuffer(nil)
+		if err := tpl.ExecuteTemplate(buff, name, data); err != nil {
+			return "", err
+		}
+
+		return template.HTML(buff.String()), nil
+	}
+}
+
 type readFileFunc func(file string) (name string, b []byte, err error)
 
 // readFile  (adapted from stdlib)
 func readFiler(t *Template, fSys fs.FS) readFileFunc {
 	return func(file string) (name string, b []byte, err error) {
+		name = file
 		if t != nil {
 			name = t.stripFileName(file)
-		} else {
-			name = file
+			file = t.fsPath(file)
 		}
 
-		if fSys != nil {
-			b, err = fs.ReadFile(fSys, file)
-		} else {
-			b, err = os.ReadFile(file)
-		}
+		b, err = fs.ReadFile(fSys, file)
 		return
 	}
 }
 
-func (t *Template) parse(templates ...string) (*template.Template, error) {
+// parse parses templates along with their layouts, references and the shared templates of s.
+// it returns the parsed template and the list of files it was built from, leaving out the shared
+// templates, see templateDeps. inline is parsed in place of stringFile when set
+func (t *Template) parse(s *snapshot, inline *inlineSource, templates ...string) (*template.Template, []string, error) {
 	var (
 		err      error
 		fileList []string
 	)
 
-	rfFunc := readFiler(t, t.fSys)
+	rfFunc := inline.readFiler(readFiler(t, t.fSys))
 	for i := 0; i < len(templates); i++ {
 		tplName := templates[i]
+		if inline != nil && tplName == stringFile {
+			fileList = append(fileList, t.inlineRelatedFiles(inline)...)
+			continue
+		}
+
 		fls, err := t.getRelatedFiles(tplName)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		fileList = append(fileList, fls...)
 	}
 
-	fileList = t.includeLayouts(fileList)
+	if fileList, err = t.includeLayouts(fileList, inline); err != nil {
+		return nil, nil, err
+	}
 
 	var tpl *template.Template
 	// parse templates
-	tpl, err = t.parseFiles(nil, rfFunc, fileList...)
+	tpl, err = parseFiles(nil, rfFunc, s.funcMap, s.sources, fileList)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// parse shared templates
-	filenames, _ := t.findFiles(t.sharedFolder, t.ext)
-	if len(filenames) > 0 {
-		return t.parseFiles(tpl, rfFunc, filenames...)
+	if len(s.sharedFiles) > 0 {
+		tpl, err = parseFiles(tpl, s.readShared, s.funcMap, s.sources, s.sharedFiles)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return tpl, nil
+	if err = s.checkComponents(s.components.Load(), tpl); err != nil {
+		return nil, nil, err
+	}
+
+	return tpl, fileList, nil
 }
 
-func (t *Template) includeLayouts(files []string) []string {
+// includeLayouts inserts the layout each template extends in front of it
+func (t *Template) includeLayouts(files []string, inline *inlineSource) ([]string, error) {
 	var fileList []string
 
 	i := 0
 	for i < len(files) {
 		fileName := files[i]
-		layout, err := t.extractLayout(fileName)
+		var layout string
+		var err error
+		if inline != nil && fileName == stringFile {
+			layout, err = t.layoutIn(string(inline.src))
+		} else {
+			layout, err = t.extractLayout(fileName)
+		}
 		if err == nil && !inFrontOf(files, i, t.cleanTemplateName(layout)) {
+			if !t.pathExists(layout) {
+				return nil, &LayoutNotFoundError{Template: t.cleanTemplateName(fileName), Layout: t.cleanTemplateName(layout)}
+			}
+
 			files = slices.Insert(files, i, t.cleanTemplateName(layout))
 			continue
 		}
 
-		fileList = append(fileList, t.absTemplateName(fileName))
+		if fileName != stringFile {
+			fileName = t.absTemplateName(fileName)
+		}
+		fileList = append(fileList, fileName)
 		i++
 	}
 
-	return fileList
+	return fileList, nil
 }
 
 func (t *Template) getRelatedFiles(tpl string) ([]string, error) {
@@ -142,7 +184,9 @@ func (t *Template) getRelatedFiles(tpl string) ([]string, error) {
 	fileList = append(fileList, absTpl)
 
 	refs, err := t.findTemplateRefs(absTpl)
-	if err != nil {
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &TemplateNotFoundError{Name: tpl, SearchedPaths: []string{absTpl}}
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -163,14 +207,18 @@ func (t *Template) getRelatedFiles(tpl string) ([]string, error) {
 var reTplAction = regexp.MustCompile(`{{\-*\s*template\s*"([^"]+)"\s*[\s\w\W]*?\-*}}`)
 
 func (t *Template) findTemplateRefs(file string) ([]string, error) {
-	var templates []string
-
 	fileName := t.absTemplateName(file)
-	src, err := os.ReadFile(fileName)
+	src, err := fs.ReadFile(t.fSys, t.fsPath(fileName))
 	if err != nil {
 		return nil, err
 	}
 
+	return templateRefs(src), nil
+}
+
+// templateRefs lists the templates referenced by template actions in src
+func templateRefs(src []byte) []string {
+	var templates []string
 	matches := reTplAction.FindAllStringSubmatch(string(src), -1)
 	for _, match := range matches {
 		if len(match) > 1 {
@@ -178,20 +226,24 @@ func (t *Template) findTemplateRefs(file string) ([]string, error) {
 		}
 	}
 
-	return slices.CompactFunc(templates, strings.EqualFold), nil
+	return slices.CompactFunc(templates, strings.EqualFold)
 }
 
 var extendsRe = regexp.MustCompile(`{{/\*\s*extends?\s*"(.*)"\s*\*/}}`)
 
+// ErrLayoutNotFound is matched by *LayoutNotFoundError
 var ErrLayoutNotFound = errors.New("layout not found")
 
+// errNoLayout is returned by extractLayout for templates that do not extend a layout
+var errNoLayout = errors.New("no layout")
+
 func (t *Template) extractLayout(name string) (string, error) {
 	name = t.cleanTemplateName(name)
 	if t.isFolder(name) {
-		return "", ErrLayoutNotFound
+		return "", errNoLayout
 	}
 
-	fle, err := os.Open(filepath.Join(t.root, name+t.ext))
+	fle, err := t.fSys.Open(t.fsPath(filepath.Join(t.root, name+t.ext)))
 	if err != nil {
 		return "", err
 	}
@@ -206,9 +258,14 @@ func (t *Template) extractLayout(name string) (string, error) {
 		}
 	}
 
+	return t.layoutIn(src)
+}
+
+// layoutIn returns the layout file the template src extends
+func (t *Template) layoutIn(src string) (string, error) {
 	match := extendsRe.FindStringSubmatch(src)
 	if len(match) < 2 {
-		return "", ErrLayoutNotFound
+		return "", errNoLayout
 	}
 
 	return filepath.Join(t.root, match[1]+t.ext), nil
@@ -0,0 +1,134 @@
+package templates
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// FileError is an error encountered while processing a template file
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return e.File + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// PrecompileError lists every template that failed to parse during Precompile
+type PrecompileError struct {
+	Errors []*FileError
+}
+
+func (e *PrecompileError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+
+	return "templates: failed to parse:\n" + strings.Join(msgs, "\n")
+}
+
+func (e *PrecompileError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Precompile parses every template under the root (except shared templates and components)
+// along with its layouts, and stores the results in the cache.
+// templates are parsed concurrently, and a *PrecompileError listing every template
+// that failed to parse is returned
+func (t *Template) Precompile(ctx context.Context) error {
+	return t.precompile(ctx, t.snapshot())
+}
+
+// precompile parses every page into the cache of s
+func (t *Template) precompile(ctx context.Context, s *snapshot) error {
+	pages, err := t.pages()
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mtx  sync.Mutex
+		errs []*FileError
+		jobs = make(chan string)
+	)
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(pages) {
+		workers = len(pages)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range jobs {
+				if _, err := t.compileOnce(s, "", page, nil); err != nil {
+					mtx.Lock()
+					errs = append(errs, &FileError{File: t.absTemplateName(page), Err: err})
+					mtx.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, page := range pages {
+		select {
+		case jobs <- page:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		slices.SortFunc(errs, func(a, b *FileError) int {
+			return strings.Compare(a.File, b.File)
+		})
+		return &PrecompileError{Errors: errs}
+	}
+
+	return nil
+}
+
+// pages lists the names of the templates under the root, excluding shared templates and components
+func (t *Template) pages() ([]string, error) {
+	filenames, err := t.findFiles(t.root, t.ext)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedFolder := t.sharedFolder + string(filepath.Separator)
+	componentFolder := filepath.Join(t.root, t.componentFolder) + string(filepath.Separator)
+
+	var pages []string
+	for _, name := range filenames {
+		if strings.HasPrefix(name, sharedFolder) || strings.HasPrefix(name, componentFolder) {
+			continue
+		}
+
+		pages = append(pages, t.cleanTemplateName(name))
+	}
+
+	return pages, nil
+}
@@ -0,0 +1,52 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Precompile(t *testing.T) {
+	tpl, err := New("./testData", options)
+	require.NoError(t, err)
+
+	require.NoError(t, tpl.Precompile(context.Background()))
+	assert.True(t, tpl.InCache("", "profile"))
+	assert.True(t, tpl.InCache("", "inFolder/grandchild"))
+	assert.False(t, tpl.InCache("", "shared/widgets"))
+	assert.False(t, tpl.InCache("", "components/card"))
+}
+
+func TestTemplate_PrecompileErrors(t *testing.T) {
+	tpl := newMapFSTemplate(t, map[string]string{
+		"broken.tmpl":          `{{ if .Name }}unterminated`,
+		"inFolder/broken.tmpl": `{{ end }}`,
+		"bad-layout.tmpl":      `{{/* extends "broken" */}}`,
+	})
+
+	err := tpl.Precompile(context.Background())
+	var pErr *PrecompileError
+	require.True(t, errors.As(err, &pErr))
+
+	var files []string
+	for _, fErr := range pErr.Errors {
+		files = append(files, fErr.File)
+	}
+	assert.Equal(t, []string{"testData/bad-layout.tmpl", "testData/broken.tmpl", "testData/inFolder/broken.tmpl"}, files)
+	assert.Contains(t, err.Error(), "testData/inFolder/broken.tmpl: ")
+
+	// templates that parse are still cached
+	assert.True(t, tpl.InCache("", "profile"))
+}
+
+func TestTemplate_PrecompileCancelled(t *testing.T) {
+	tpl, err := New("./testData", options)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, tpl.Precompile(ctx), context.Canceled)
+}
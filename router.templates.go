@@ -0,0 +1,200 @@
+package templates
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Route is a page served by a Router
+type Route struct {
+	// Pattern is the url path the page is served at, dynamic segments are in brackets e.g. /veggies/[id]
+	Pattern string
+	// Template is the name of the template rendered for the page
+	Template string
+}
+
+// segments splits the pattern of r into its path segments
+func (r Route) segments() []string {
+	if r.Pattern == "/" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimPrefix(r.Pattern, "/"), "/")
+}
+
+// Router is an http.Handler that serves the templates under the root as pages.
+// about.tmpl is served at /about, veggies/carrots.tmpl at /veggies/carrots and an index.tmpl at the
+// path of its folder. a segment named in brackets e.g. veggies/[id].tmpl matches any value,
+// which is passed to the page in its params. templates extended as layouts, and the 404 and 500
+// templates are not served
+type Router struct {
+	t    *Template
+	opts RenderOption
+
+	mtx    sync.Mutex
+	snap   *snapshot
+	routes []Route
+}
+
+// Router returns a router serving the templates under the root. pages are rendered with opts.
+// when opts.Data is nil pages are rendered with the data of their loader, which is passed
+// the route params, or the route params when they have no loader
+func (t *Template) Router(opts RenderOption) (*Router, error) {
+	r := &Router{t: t, opts: opts}
+	if _, err := r.table(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Routes lists the routes served, in the order they are matched
+func (r *Router) Routes() []Route {
+	routes, _ := r.table()
+	return slices.Clone(routes)
+}
+
+// table returns the routes for the current snapshot, enumerating them again when templates were
+// added or removed since they were last listed
+func (r *Router) table() ([]Route, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	s := r.t.snapshot()
+	if s == r.snap {
+		return r.routes, nil
+	}
+
+	routes, err := r.t.routes(r.opts.Layout)
+	if err != nil {
+		return r.routes, err
+	}
+
+	r.snap, r.routes = s, routes
+	return routes, nil
+}
+
+// routes lists the routes of the pages under the root, static segments are matched before dynamic ones
+func (t *Template) routes(layout string) ([]Route, error) {
+	pages, err := t.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := map[string]bool{"404": true, "500": true}
+	if layout != "" {
+		excluded[layout] = true
+	}
+	for _, page := range pages {
+		if l, err := t.extractLayout(page); err == nil {
+			excluded[filepath.ToSlash(t.cleanTemplateName(l))] = true
+		}
+	}
+
+	var routes []Route
+	seen := map[string]bool{}
+	for _, page := range pages {
+		name := filepath.ToSlash(page)
+		if excluded[name] {
+			continue
+		}
+
+		pattern := "/" + name
+		if path.Base(name) == "index" {
+			pattern = "/" + strings.TrimSuffix(strings.TrimSuffix(name, "index"), "/")
+		}
+		// veggies.tmpl is preferred to veggies/index.tmpl
+		if seen[pattern] && path.Base(name) == "index" {
+			continue
+		}
+		if seen[pattern] {
+			routes = slices.DeleteFunc(routes, func(r Route) bool { return r.Pattern == pattern })
+		}
+
+		seen[pattern] = true
+		routes = append(routes, Route{Pattern: pattern, Template: name})
+	}
+
+	slices.SortFunc(routes, compareRoutes)
+	return routes, nil
+}
+
+// compareRoutes orders routes by their segments, static segments before dynamic ones
+func compareRoutes(a, b Route) int {
+	as, bs := a.segments(), b.segments()
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		ad, bd := isDynamic(as[i]), isDynamic(bs[i])
+		switch {
+		case ad && !bd:
+			return 1
+		case !ad && bd:
+			return -1
+		case as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+
+	return len(as) - len(bs)
+}
+
+func isDynamic(segment string) bool {
+	return len(segment) > 2 && segment[0] == '[' && segment[len(segment)-1] == ']'
+}
+
+// Match returns the route for urlPath along with the values of its dynamic segments
+func (r *Router) Match(urlPath string) (Route, map[string]string, bool) {
+	routes, _ := r.table()
+
+	urlPath = strings.Trim(path.Clean("/"+urlPath), "/")
+	var segments []string
+	if urlPath != "" {
+		segments = strings.Split(urlPath, "/")
+	}
+
+	for _, route := range routes {
+		if params, ok := matchSegments(route.segments(), segments); ok {
+			return route, params, true
+		}
+	}
+
+	return Route{}, nil, false
+}
+
+func matchSegments(pattern, segments []string) (map[string]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, p := range pattern {
+		if isDynamic(p) {
+			params[p[1:len(p)-1]] = segments[i]
+		} else if p != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	route, params, ok := r.Match(req.URL.Path)
+	if !ok {
+		r.t.respondError(w, req, &TemplateNotFoundError{Name: req.URL.Path})
+		return
+	}
+
+	option := r.opts
+	option.Template = route.Template
+	_ = r.t.respond(w, req, http.StatusOK, option, params)
+}
@@ -0,0 +1,83 @@
+package templates
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	mfs := fstest.MapFS{
+		"site/base.tmpl":                  {Data: []byte(`<main>{{ block "content" . }}{{ end }}</main>`)},
+		"site/index.tmpl":                 {Data: []byte(`home`)},
+		"site/about.tmpl":                 {Data: []byte(`{{/* extends "base" */}}{{ define "content" }}about{{ end }}`)},
+		"site/404.tmpl":                   {Data: []byte(`no page at {{ .Request.URL.Path }}`)},
+		"site/veggies/index.tmpl":         {Data: []byte(`all veggies`)},
+		"site/veggies/carrots.tmpl":       {Data: []byte(`carrots`)},
+		"site/veggies/[id].tmpl":          {Data: []byte(`veggie {{ .id }}`)},
+		"site/users/[user]/[album].tmpl":  {Data: []byte(`{{ .album }} by {{ .user }}`)},
+		"site/shared/widget.tmpl":         {Data: []byte(`{{ define "widget" }}w{{ end }}`)},
+		"site/components/button.tmpl":     {Data: []byte(`<button></button>`)},
+		"site/users/[user]/settings.tmpl": {Data: []byte(`settings of {{ .user }}`)},
+	}
+
+	tpl, err := New("site", &TemplateOptions{FS: mfs})
+	require.NoError(t, err)
+
+	router, err := tpl.Router(RenderOption{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []Route{
+		{Pattern: "/", Template: "index"},
+		{Pattern: "/about", Template: "about"},
+		{Pattern: "/users/[user]/settings", Template: "users/[user]/settings"},
+		{Pattern: "/users/[user]/[album]", Template: "users/[user]/[album]"},
+		{Pattern: "/veggies", Template: "veggies/index"},
+		{Pattern: "/veggies/carrots", Template: "veggies/carrots"},
+		{Pattern: "/veggies/[id]", Template: "veggies/[id]"},
+	}, router.Routes())
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	for path, want := range map[string]string{
+		"/":                   "home",
+		"/about":              "<main>about</main>",
+		"/veggies/":           "all veggies",
+		"/veggies/carrots":    "carrots",
+		"/veggies/kale":       "veggie kale",
+		"/users/ayo/settings": "settings of ayo",
+		"/users/ayo/holiday":  "holiday by ayo",
+	} {
+		code, body := get(path)
+		assert.Equal(t, http.StatusOK, code, path)
+		assert.Equal(t, want, body, path)
+	}
+
+	code, body := get("/veggies/kale/leaves")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "no page at /veggies/kale/leaves", body)
+
+	route, params, ok := router.Match("/users/ayo/holiday")
+	require.True(t, ok)
+	assert.Equal(t, "users/[user]/[album]", route.Template)
+	assert.Equal(t, map[string]string{"user": "ayo", "album": "holiday"}, params)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/about", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	// routes follow the templates when they are reloaded
+	mfs["site/contact.tmpl"] = &fstest.MapFile{Data: []byte(`contact`)}
+	require.NoError(t, tpl.Reload())
+	code, body = get("/contact")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "contact", body)
+}
@@ -0,0 +1,360 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"time"
+)
+
+var (
+	// ErrFuncNotAllowed is matched by a *SandboxError for a call to a function not in Sandbox.Funcs
+	ErrFuncNotAllowed = errors.New("function not allowed")
+	// ErrComponentNotAllowed is matched by a *SandboxError for a component not in Sandbox.Components
+	ErrComponentNotAllowed = errors.New("component not allowed")
+	// ErrOutputLimit is matched by a *SandboxError for output larger than Sandbox.MaxOutput
+	ErrOutputLimit = errors.New("output limit exceeded")
+	// ErrDepthLimit is matched by a *SandboxError for templates nested deeper than Sandbox.MaxDepth
+	ErrDepthLimit = errors.New("depth limit exceeded")
+	// ErrTimeout is matched by a *SandboxError for a render running longer than Sandbox.Timeout
+	ErrTimeout = errors.New("timeout")
+)
+
+// maxCaptureDepth is how deep the blocks captured from between component tags may nest
+// in a sandbox without a MaxDepth
+const maxCaptureDepth = 100
+
+// sandboxBuiltins are the builtin functions of text/template allowed in every sandbox,
+// along with the functions component tags are rewritten to
+var sandboxBuiltins = []string{
+	"and", "or", "not", "len", "index", "print", "printf", "println",
+	"eq", "ne", "lt", "le", "gt", "ge",
+	"map", "_scope", "_capture",
+}
+
+// Sandbox limits what a template from an untrusted source can do, see Template.Sandboxed
+type Sandbox struct {
+	// Funcs lists the functions of the FuncMap the template may call, on top of the comparison,
+	// logic and printing builtins of text/template
+	Funcs []string
+	// Components lists the components the template may use
+	Components []string
+	// Timeout is the longest a render may take, when set
+	Timeout time.Duration
+	// MaxOutput is the most bytes a render may write, when set. it also limits the content captured
+	// from between component tags and the output of every component
+	MaxOutput int
+	// MaxDepth is the deepest templates, blocks and components may be nested, when set
+	MaxDepth int
+}
+
+// SandboxError is returned when a template rendered in a Sandbox breaks one of its limits.
+// it matches Rule, one of ErrFuncNotAllowed, ErrComponentNotAllowed, ErrOutputLimit, ErrDepthLimit
+// or ErrTimeout
+type SandboxError struct {
+	Rule error
+	// Name is the function or component that is not allowed
+	Name string
+	// Line is the line of the source the function or component is used on
+	Line int
+	// Limit is the limit that was exceeded
+	Limit any
+	// Err is the error the limit was detected by
+	Err error
+}
+
+func (e *SandboxError) Error() string {
+	var loc string
+	if e.Line > 0 {
+		loc = location(stringFile, e.Line)
+	}
+
+	switch e.Rule {
+	case ErrFuncNotAllowed:
+		return fmt.Sprintf("template: %sfunction %q is not allowed", loc, e.Name)
+	case ErrComponentNotAllowed:
+		return fmt.Sprintf("template: %scomponent %q is not allowed", loc, e.Name)
+	case ErrOutputLimit:
+		return fmt.Sprintf("template: output exceeds %v bytes", e.Limit)
+	case ErrDepthLimit:
+		return fmt.Sprintf("template: templates nested deeper than %v", e.Limit)
+	case ErrTimeout:
+		return fmt.Sprintf("template: render took longer than %v", e.Limit)
+	}
+
+	return "template: " + e.Rule.Error()
+}
+
+func (e *SandboxError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Rule}
+	}
+
+	return []error{e.Rule, e.Err}
+}
+
+// Sandboxed renders src with data within the limits of sandbox. src is parsed on its own, without
+// layouts or shared templates, and may only call the functions and components the sandbox allows.
+// the components themselves are trusted, and the text of src is output as is. once ctx is done the
+// render stops at its next write or range iteration
+func (t *Template) Sandboxed(ctx context.Context, sandbox Sandbox, src string, data any) (string, error) {
+	s := t.snapshot()
+	c, err := s.sandboxTemplate(sandbox, src)
+	if err != nil {
+		return "", err
+	}
+
+	if sandbox.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sandbox.Timeout)
+		defer cancel()
+	}
+
+	maxDepth := sandbox.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = maxCaptureDepth
+	}
+	inst, err := c.instance(binding{ctx: ctx, limit: sandbox.MaxOutput, maxDepth: maxDepth})
+	if err != nil {
+		return "", err
+	}
+
+	// the render is left to stop on its own when the context is done first, so it is given
+	// a buffer of its own, which fails every write from then on
+	buff := new(bytes.Buffer)
+	w := &limitWriter{ctx: ctx, w: buff, max: sandbox.MaxOutput}
+	done := make(chan error, 1)
+	go func() {
+		defer c.put(inst)
+		done <- inst.tpl.Execute(w, data)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	switch {
+	case err == nil:
+		return buff.String(), nil
+	case errors.Is(err, ErrOutputLimit):
+		return "", &SandboxError{Rule: ErrOutputLimit, Limit: sandbox.MaxOutput}
+	case errors.Is(err, ErrDepthLimit):
+		return "", &SandboxError{Rule: ErrDepthLimit, Limit: maxDepth}
+	case errors.Is(err, context.DeadlineExceeded) && sandbox.Timeout > 0:
+		return "", &SandboxError{Rule: ErrTimeout, Limit: sandbox.Timeout, Err: err}
+	}
+
+	return "", s.sources.rewrite(err)
+}
+
+// sandboxTemplate returns src parsed and checked against sandbox, from the string cache of s
+func (s *snapshot) sandboxTemplate(sandbox Sandbox, src string) (*compiled, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %d\x00%s", sandbox.Funcs, sandbox.Components, sandbox.MaxDepth, src)
+	name := "sandbox-" + hex.EncodeToString(h.Sum(nil)[:16])
+
+	key := newCacheKey("", name, nil)
+	if c := s.strings.get(key); c != nil {
+		return c, nil
+	}
+
+	out, spans, err := rewriteComponents(name, []byte(src))
+	if err != nil {
+		return nil, withFile(err, stringFile)
+	}
+	sm := newSourceMap(stringFile, []byte(src), out, spans)
+
+	tpl := template.New(name).Funcs(s.funcMap)
+	if _, err = tpl.Parse(string(out)); err != nil {
+		return nil, rewriteError(err, func(string) *sourceMap { return sm })
+	}
+	tpl.Funcs(template.FuncMap{"_capture": captureFunc(tpl)})
+
+	if err = checkSandbox(tpl, sandbox, sm); err != nil {
+		return nil, err
+	}
+	for _, tmpl := range tpl.Templates() {
+		if tmpl.Tree != nil {
+			stepRanges(tmpl.Tree.Root)
+		}
+	}
+
+	c := newCompiled(tpl, s)
+	s.sources.set(name, sm)
+	s.cacheString(key, c)
+	return c, nil
+}
+
+// stepCheck is put at the start of every range of a sandboxed template, the _step builtin
+// fails once the context of the render is done
+var stepCheck = func() parse.Node {
+	trees, err := parse.Parse("_step", "{{ if _step }}{{ end }}", "", "", map[string]any{"_step": true})
+	if err != nil {
+		panic(err)
+	}
+
+	return trees["_step"].Root.Nodes[0]
+}()
+
+// stepRanges puts a copy of stepCheck at the start of every range in the tree rooted at node,
+// so loops that write nothing still stop once the render is done
+func stepRanges(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			stepRanges(child)
+		}
+	case *parse.IfNode:
+		stepRanges(n.List)
+		stepRanges(n.ElseList)
+	case *parse.RangeNode:
+		stepRanges(n.List)
+		stepRanges(n.ElseList)
+		n.List.Nodes = append([]parse.Node{stepCheck.Copy()}, n.List.Nodes...)
+	case *parse.WithNode:
+		stepRanges(n.List)
+		stepRanges(n.ElseList)
+	}
+}
+
+// checkSandbox returns a *SandboxError for the first function or component in tpl the sandbox
+// does not allow, or when its templates nest deeper than the sandbox allows
+func checkSandbox(tpl *template.Template, sandbox Sandbox, sm *sourceMap) error {
+	templates := tpl.Templates()
+	slices.SortFunc(templates, func(a, b *template.Template) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	for _, tmpl := range templates {
+		if tmpl.Tree == nil {
+			continue
+		}
+
+		var sErr *SandboxError
+		walkNodes(tmpl.Tree.Root, func(cmd *parse.CommandNode) {
+			if sErr == nil {
+				sErr = sandboxCommand(tpl, cmd, sandbox)
+				if sErr != nil {
+					sErr.Line = sandboxLine(tmpl.Tree, cmd, sm, sErr)
+				}
+			}
+		})
+		if sErr != nil {
+			return sErr
+		}
+	}
+
+	if sandbox.MaxDepth > 0 && templateDepth(tpl, tpl.Name(), map[string]int{}) > sandbox.MaxDepth {
+		return &SandboxError{Rule: ErrDepthLimit, Limit: sandbox.MaxDepth}
+	}
+
+	return nil
+}
+
+// sandboxCommand returns the error for cmd calling a function or component the sandbox does not allow.
+// _capture may only render the blocks component tags are rewritten to, named by a literal
+func sandboxCommand(tpl *template.Template, cmd *parse.CommandNode, sandbox Sandbox) *SandboxError {
+	for i, arg := range cmd.Args {
+		ident, ok := arg.(*parse.IdentifierNode)
+		if !ok {
+			continue
+		}
+
+		if ident.Ident == "component" && i == 0 {
+			name, ok := componentName(cmd)
+			if !ok || !slices.ContainsFunc(sandbox.Components, func(c string) bool { return strings.EqualFold(c, name) }) {
+				return &SandboxError{Rule: ErrComponentNotAllowed, Name: name}
+			}
+			continue
+		}
+
+		if ident.Ident == "_capture" && (i != 0 || !capturesBlock(tpl, cmd)) {
+			return &SandboxError{Rule: ErrFuncNotAllowed, Name: ident.Ident}
+		}
+
+		if !slices.Contains(sandboxBuiltins, ident.Ident) && !slices.Contains(sandbox.Funcs, ident.Ident) {
+			return &SandboxError{Rule: ErrFuncNotAllowed, Name: ident.Ident}
+		}
+	}
+
+	return nil
+}
+
+// capturesBlock reports whether cmd captures one of the blocks of tpl taken from between component tags
+func capturesBlock(tpl *template.Template, cmd *parse.CommandNode) bool {
+	if len(cmd.Args) < 2 {
+		return false
+	}
+
+	str, ok := cmd.Args[1].(*parse.StringNode)
+	return ok && strings.HasPrefix(str.Text, "_"+tpl.Name()+":") && tpl.Lookup(str.Text) != nil
+}
+
+// sandboxLine returns the line of the source cmd is on, taking the name of a component from its tag
+func sandboxLine(tree *parse.Tree, cmd *parse.CommandNode, sm *sourceMap, sErr *SandboxError) int {
+	loc, _ := tree.ErrorContext(cmd)
+	m := reNodeLocation.FindStringSubmatch(loc)
+	if m == nil {
+		return 0
+	}
+
+	line, _ := strconv.Atoi(m[1])
+	col, _ := strconv.Atoi(m[2])
+	line, _, tag := sm.locate(line, col)
+	if tag != nil && sErr.Rule == ErrComponentNotAllowed {
+		sErr.Name = tag.Name
+	}
+
+	return line
+}
+
+// templateDepth returns how deep the templates, blocks and components called from the template
+// name nest, counting name. a template that calls itself nests without end
+func templateDepth(tpl *template.Template, name string, depths map[string]int) int {
+	const unbounded = 1 << 30
+
+	if d, found := depths[name]; found {
+		if d == 0 {
+			// still being measured, so it calls itself
+			return unbounded
+		}
+		return d
+	}
+
+	tmpl := tpl.Lookup(name)
+	if tmpl == nil || tmpl.Tree == nil {
+		return 1
+	}
+
+	depths[name] = 0
+	deepest := 0
+	walkCalls(tmpl.Tree.Root, func(callee string, component bool) {
+		d := 1
+		if !component {
+			d = templateDepth(tpl, callee, depths)
+		}
+		if d > deepest {
+			deepest = d
+		}
+	})
+
+	d := deepest + 1
+	if d > unbounded {
+		d = unbounded
+	}
+	depths[name] = d
+	return d
+}
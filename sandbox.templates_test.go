@@ -0,0 +1,183 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sandboxTemplates(t *testing.T) *Template {
+	mfs := fstest.MapFS{
+		"site/shared/secret.tmpl":   {Data: []byte(`{{ define "secret" }}{{ html "<b>secret</b>" }}{{ end }}`)},
+		"site/components/card.tmpl": {Data: []byte(`<div class="card">{{ html "<hr>" }}{{ .children }}</div>`)},
+		"site/components/link.tmpl": {Data: []byte(`<a href="{{ .href }}">{{ .children }}</a>`)},
+		"site/components/big.tmpl":  {Data: []byte(`{{ range .items }}0123456789{{ end }}`)},
+	}
+	tpl, err := New("site", &TemplateOptions{FS: mfs, FuncMap: template.FuncMap{
+		"upper": strings.ToUpper,
+		"sleep": func(d time.Duration) string { time.Sleep(d); return "" },
+	}})
+	require.NoError(t, err)
+
+	return tpl
+}
+
+func TestTemplate_Sandboxed(t *testing.T) {
+	tpl := sandboxTemplates(t)
+	sandbox := Sandbox{Funcs: []string{"upper"}, Components: []string{"card"}, MaxDepth: 3}
+
+	out, err := tpl.Sandboxed(context.Background(), sandbox,
+		`{{ define "name" }}{{ upper .Name }}{{ end }}<Card>hi {{ template "name" . }}{{ if eq .Name "ayo" }}!{{ end }}</Card>`,
+		map[string]any{"Name": "ayo"})
+	require.NoError(t, err)
+	assert.Equal(t, `<div class="card"><hr>hi AYO!</div>`, out)
+
+	// output is escaped
+	out, err = tpl.Sandboxed(context.Background(), sandbox, `<p>{{ . }}</p>`, "<script>")
+	require.NoError(t, err)
+	assert.Equal(t, `<p>&lt;script&gt;</p>`, out)
+
+	// shared templates are not parsed with the source
+	_, err = tpl.Sandboxed(context.Background(), sandbox, `{{ template "secret" }}`, nil)
+	assert.ErrorContains(t, err, `no such template "secret"`)
+}
+
+func TestTemplate_Sandboxed_notAllowed(t *testing.T) {
+	tpl := sandboxTemplates(t)
+	sandbox := Sandbox{Funcs: []string{"upper"}, Components: []string{"card"}}
+
+	tests := []struct {
+		name string
+		src  string
+		rule error
+		err  string
+	}{
+		{"func", "hi\n{{ html .Body }}", ErrFuncNotAllowed, `template: <string>:2: function "html" is not allowed`},
+		{"func in pipeline", `{{ .Body | upper | html }}`, ErrFuncNotAllowed, `template: <string>:1: function "html" is not allowed`},
+		{"func as argument", `{{ printf "%s" sleep }}`, ErrFuncNotAllowed, `template: <string>:1: function "sleep" is not allowed`},
+		{"func in chain", `{{ (html "x").Y }}`, ErrFuncNotAllowed, `template: <string>:1: function "html" is not allowed`},
+		{"builtin", `{{ call .Fn }}`, ErrFuncNotAllowed, `template: <string>:1: function "call" is not allowed`},
+		{"func in block", `{{ block "b" . }}{{ html "x" }}{{ end }}`, ErrFuncNotAllowed, `template: <string>:1: function "html" is not allowed`},
+		{"component", "<Card>\n  <Link href=\"/\">home</Link>\n</Card>", ErrComponentNotAllowed, `template: <string>:2: component "Link" is not allowed`},
+		{"component func", `{{ component "link" (map) }}`, ErrComponentNotAllowed, `template: <string>:1: component "link" is not allowed`},
+		{"dynamic component", `{{ component .Name (map) }}`, ErrComponentNotAllowed, `template: <string>:1: component "" is not allowed`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tpl.Sandboxed(context.Background(), sandbox, tt.src, nil)
+			var sErr *SandboxError
+			require.ErrorAs(t, err, &sErr)
+			assert.ErrorIs(t, err, tt.rule)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestTemplate_Sandboxed_limits(t *testing.T) {
+	tpl := sandboxTemplates(t)
+
+	_, err := tpl.Sandboxed(context.Background(), Sandbox{MaxOutput: 10}, `{{ range . }}0123456789{{ end }}`, []int{1, 2})
+	assert.ErrorIs(t, err, ErrOutputLimit)
+	assert.EqualError(t, err, "template: output exceeds 10 bytes")
+
+	out, err := tpl.Sandboxed(context.Background(), Sandbox{MaxOutput: 10}, `{{ range . }}01234{{ end }}`, []int{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, "0123401234", out)
+
+	nested := `{{ define "a" }}{{ template "b" }}{{ end }}{{ define "b" }}b{{ end }}{{ template "a" }}`
+	out, err = tpl.Sandboxed(context.Background(), Sandbox{MaxDepth: 3}, nested, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "b", out)
+
+	_, err = tpl.Sandboxed(context.Background(), Sandbox{MaxDepth: 2}, nested, nil)
+	assert.ErrorIs(t, err, ErrDepthLimit)
+	assert.EqualError(t, err, "template: templates nested deeper than 2")
+
+	_, err = tpl.Sandboxed(context.Background(), Sandbox{Components: []string{"card"}, MaxDepth: 2}, `<Card><Card>x</Card></Card>`, nil)
+	assert.ErrorIs(t, err, ErrDepthLimit)
+
+	// templates calling themselves nest without end
+	_, err = tpl.Sandboxed(context.Background(), Sandbox{MaxDepth: 100}, `{{ define "loop" }}{{ template "loop" . }}{{ end }}{{ template "loop" . }}`, nil)
+	assert.ErrorIs(t, err, ErrDepthLimit)
+
+	start := time.Now()
+	_, err = tpl.Sandboxed(context.Background(), Sandbox{Funcs: []string{"sleep"}, Timeout: 20 * time.Millisecond}, `{{ sleep .}}`, time.Second)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, "template: render took longer than 20ms")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = tpl.Sandboxed(ctx, Sandbox{}, `hi`, nil)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestTemplate_Sandboxed_captures(t *testing.T) {
+	tpl := sandboxTemplates(t)
+
+	// only the blocks taken from between component tags can be captured
+	_, err := tpl.Sandboxed(context.Background(), Sandbox{MaxDepth: 3, Timeout: 2 * time.Second},
+		`{{define "x"}}{{ _capture (print "x") . }}{{end}}{{ _capture (print "x") . }}`, nil)
+	assert.ErrorIs(t, err, ErrFuncNotAllowed)
+	assert.EqualError(t, err, `template: <string>:1: function "_capture" is not allowed`)
+
+	_, err = tpl.Sandboxed(context.Background(), Sandbox{MaxOutput: 1000},
+		`{{define "x"}}{{range $i := 3000}}{{printf "%0100000d" 1}}{{end}}{{end}}{{ len (_capture "x" .) }}`, nil)
+	assert.ErrorIs(t, err, ErrFuncNotAllowed)
+
+	// captured blocks and components are limited like the output
+	sandbox := Sandbox{Components: []string{"card", "big"}, MaxOutput: 1000}
+	_, err = tpl.Sandboxed(context.Background(), sandbox, `<Card>{{ range . }}{{ printf "%0100000d" 1 }}{{ end }}</Card>`, make([]int, 3000))
+	assert.ErrorIs(t, err, ErrOutputLimit)
+
+	_, err = tpl.Sandboxed(context.Background(), sandbox, `{{ len (component "big" (map "items" .)) }}`, make([]int, 1000000))
+	assert.ErrorIs(t, err, ErrOutputLimit)
+
+	out, err := tpl.Sandboxed(context.Background(), sandbox, `{{ len (component "big" (map "items" .)) }}`, make([]int, 10))
+	require.NoError(t, err)
+	assert.Equal(t, "100", out)
+}
+
+func TestInstance_capture_depth(t *testing.T) {
+	tpl := sandboxTemplates(t)
+	s := tpl.snapshot()
+
+	// each capture is executed on its own, so nesting is counted by the instance
+	rec := template.Must(template.New("rec").Funcs(s.funcMap).Parse(`{{ define "r" }}{{ _capture "r" . }}{{ end }}`))
+	c := newCompiled(rec, s)
+	inst, err := c.instance(binding{ctx: context.Background(), maxDepth: 3})
+	require.NoError(t, err)
+	defer c.put(inst)
+
+	_, err = inst.capture("r", nil)
+	assert.ErrorIs(t, err, ErrDepthLimit)
+}
+
+func TestTemplate_Sandboxed_stops(t *testing.T) {
+	tpl := sandboxTemplates(t)
+	before := runtime.NumGoroutine()
+
+	// loops that write nothing stop at their next iteration once the render times out
+	items := make([]struct{}, math.MaxInt32)
+	for _, src := range []string{`{{ range . }}{{ end }}`, `{{ define "loop" }}{{ if . }}{{ range . }}{{ end }}{{ end }}{{ end }}{{ template "loop" . }}`} {
+		_, err := tpl.Sandboxed(context.Background(), Sandbox{Timeout: 20 * time.Millisecond}, src, items)
+		assert.ErrorIs(t, err, ErrTimeout)
+	}
+
+	// the render goroutines exit
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
@@ -3,6 +3,7 @@ package scanner
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 )
@@ -12,6 +13,9 @@ type Scanner struct {
 	position int
 	line     int
 	lastCh   rune
+	lastSize int
+	// peeked holds tokens pushed back by backup
+	peeked []*TokenItem
 }
 
 func NewScanner(r io.Reader) *Scanner {
@@ -20,7 +24,7 @@ func NewScanner(r io.Reader) *Scanner {
 
 func (s *Scanner) read() rune {
 	var err error
-	s.lastCh, _, err = s.r.ReadRune()
+	s.lastCh, s.lastSize, err = s.r.ReadRune()
 	if err != nil {
 		return eof
 	}
@@ -28,13 +32,14 @@ func (s *Scanner) read() rune {
 		s.line++
 	}
 
-	s.position++
+	// positions are byte offsets, so they can be used to slice the input
+	s.position += s.lastSize
 	return s.lastCh
 }
 
 func (s *Scanner) unread() {
 	_ = s.r.UnreadRune()
-	s.position--
+	s.position -= s.lastSize
 	if s.lastCh == '\n' {
 		s.line--
 	}
@@ -51,43 +56,215 @@ func (s *Scanner) newTokenItem(token Token, literal string) *TokenItem {
 	return ti
 }
 
-//
-// func (s *Scanner) ParseTagHead() (*templates.Tag, error) {
-// 	var (
-// 		tkItem *TokenItem
-// 		err    error
-// 	)
-// 	// look for tag start
-// 	for {
-// 		tkItem = s.Scan()
-// 		if tkItem.Token == EOF {
-// 			break
-// 		} else if tkItem.Token == TagStart {
-// 			s.unread()
-// 			break
-// 		}
-// 	}
-//
-// 	tag := new(templates.Tag)
-// 	if tkItem.Token == TagStart {
-// 		return nil, nil
-// 	}
-//
-// 	// next token must be an Identifier
-// 	tkItem = s.Scan()
-// 	if tkItem.Token != Identifier {
-// 		return nil, nil
-// 	}
-// 	tag.Name = tkItem.Literal
-//
-// 	// parse args if any
-// 	tag.Args, err = s.parseArgs(RightAngleBracket)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-//
-// 	return tag, nil
-// }
+// TagHead is a component tag found by ParseTagHead.
+// Start and End are the byte offsets of the tag, "<" to ">" inclusive, in the scanned input
+type TagHead struct {
+	Name          string
+	Args          map[string]string
+	IsSelfClosing bool
+	IsEnd         bool
+	Start         int
+	End           int
+	Line          int
+}
+
+// ErrUnterminatedTag is returned (wrapped in a *TagError) when the input ends before a tag is closed with ">"
+var ErrUnterminatedTag = errors.New("unterminated tag")
+
+// TagError is an error found while parsing the tag Name, which starts on Line (0 based)
+type TagError struct {
+	Name string
+	Line int
+	Err  error
+}
+
+func (e *TagError) Error() string {
+	return fmt.Sprintf("%s on line:%d: %v", e.Name, e.Line, e.Err)
+}
+
+func (e *TagError) Unwrap() error {
+	return e.Err
+}
+
+// ParseTagHead scans up to the next component tag and parses it, returning nil when there are
+// no more tags. {{ }} actions are skipped, and quoted attribute values and actions within a
+// tag may contain ">"
+func (s *Scanner) ParseTagHead() (*TagHead, error) {
+	for {
+		item := s.next()
+		switch item.Token {
+		case TokenEOF:
+			return nil, nil
+		case TokenOther:
+			if s.actionStart(item) != nil {
+				if _, err := s.scanAction(); err != nil {
+					// leave unterminated actions for the template parser to report
+					return nil, nil
+				}
+			}
+		case TokenTagStart, TokenClosingTagStart, TokenLeftAngleBracket:
+			head, err := s.parseTag(item)
+			if err != nil {
+				return nil, err
+			}
+			if head != nil {
+				return head, nil
+			}
+		}
+	}
+}
+
+// parseTag parses the tag opened by start, returning nil if start does not open a component tag
+func (s *Scanner) parseTag(start *TokenItem) (*TagHead, error) {
+	head := &TagHead{
+		IsEnd: start.Token == TokenClosingTagStart,
+		Start: start.StartPosition,
+		Line:  start.Line,
+	}
+
+	item := s.next()
+	if start.Token == TokenLeftAngleBracket {
+		// allow for "< Card" and "</ Card"
+		if item.Token == TokenBackSlash {
+			head.IsEnd = true
+			item = s.next()
+		}
+		if item.Token != TokenWhiteSpace {
+			s.backup(item)
+			return nil, nil
+		}
+		item = s.next()
+	}
+
+	if item.Token != TokenIdentifier || !isUpperCaseLetter(rune(item.Literal[0])) {
+		s.backup(item)
+		return nil, nil
+	}
+	head.Name = item.Literal
+
+	var (
+		items []*TokenItem
+		quote = TokenNone
+	)
+	for {
+		item = s.next()
+		if item.Token == TokenEOF {
+			return nil, &TagError{Name: head.Name, Line: head.Line, Err: ErrUnterminatedTag}
+		}
+
+		if brace := s.actionStart(item); brace != nil {
+			action, err := s.scanAction()
+			if err != nil {
+				return nil, &TagError{Name: head.Name, Line: head.Line, Err: err}
+			}
+			items = append(items, item, brace)
+			items = append(items, action...)
+			continue
+		}
+
+		switch {
+		case quote != TokenNone:
+			if item.Token == quote {
+				quote = TokenNone
+			}
+		case item.Token == TokenSingleQuote || item.Token == TokenDoubleQuote:
+			quote = item.Token
+		case item.Token == TokenRightAngleBracket || item.Token == TokenTagSelfClosing:
+			head.IsSelfClosing = item.Token == TokenTagSelfClosing
+			head.End = item.EndPosition
+			if head.IsEnd {
+				return head, nil
+			}
+
+			args, err := parseArgItems(append(items, s.newTokenItem(TokenEOF, "")), TokenEOF)
+			if err != nil {
+				return nil, &TagError{Name: head.Name, Line: head.Line, Err: err}
+			}
+			head.Args = args
+			return head, nil
+		}
+
+		items = append(items, item)
+	}
+}
+
+// actionStart returns the second brace when item opens a {{ }} action, and nil otherwise
+func (s *Scanner) actionStart(item *TokenItem) *TokenItem {
+	if item.Token != TokenOther || item.Literal != "{" {
+		return nil
+	}
+
+	next := s.next()
+	if next.Token == TokenOther && next.Literal == "{" {
+		return next
+	}
+	s.backup(next)
+	return nil
+}
+
+// scanAction returns the tokens of an action after its opening braces, up to and including
+// the closing braces. strings and comments within the action may contain braces
+func (s *Scanner) scanAction() ([]*TokenItem, error) {
+	var (
+		items   []*TokenItem
+		quote   = TokenNone
+		comment bool
+	)
+
+	for {
+		item := s.next()
+		if item.Token == TokenEOF {
+			return nil, errors.New("unterminated action")
+		}
+		items = append(items, item)
+
+		switch {
+		case quote != TokenNone:
+			if item.Token == quote {
+				quote = TokenNone
+			}
+		case comment:
+			if item.Literal == "*" {
+				if next := s.next(); next.Token == TokenBackSlash {
+					items = append(items, next)
+					comment = false
+				} else {
+					s.backup(next)
+				}
+			}
+		case item.Token == TokenDoubleQuote || item.Token == TokenSingleQuote || item.Token == TokenTripleQuote:
+			quote = item.Token
+		case item.Token == TokenBackSlash:
+			if next := s.next(); next.Literal == "*" {
+				items = append(items, next)
+				comment = true
+			} else {
+				s.backup(next)
+			}
+		case item.Literal == "}":
+			next := s.next()
+			if next.Literal == "}" {
+				return append(items, next), nil
+			}
+			s.backup(next)
+		}
+	}
+}
+
+// next returns the token pushed back by backup, or scans the next one
+func (s *Scanner) next() *TokenItem {
+	if n := len(s.peeked); n > 0 {
+		item := s.peeked[n-1]
+		s.peeked = s.peeked[:n-1]
+		return item
+	}
+
+	return s.Scan()
+}
+
+func (s *Scanner) backup(item *TokenItem) {
+	s.peeked = append(s.peeked, item)
+}
 
 func (s *Scanner) ParseTagArgs() (map[string]string, error) {
 
@@ -104,17 +281,22 @@ func (s *Scanner) parseArgs(until Token) (map[string]string, error) {
 	// name="mayo" class="{{ if eq .Name "mayo" }}123{{end}}"
 	// Identifier, Assign, DoubleQuote, Identifier, DoubleQuote, WhiteSpace
 
-	var (
-		wrkItems []*TokenItem
-		item     *TokenItem
-		args     = map[string]string{}
-		err      error
-	)
 	wrkItems, lastTokenItem := s.ScanUntil(until, false)
 	if lastTokenItem.Token != until {
 		return nil, fmt.Errorf("closing token %s not found", until)
 	}
 
+	return parseArgItems(wrkItems, until)
+}
+
+// parseArgItems parses name="value" pairs from items, up to the until token
+func parseArgItems(wrkItems []*TokenItem, until Token) (map[string]string, error) {
+	var (
+		item *TokenItem
+		args = map[string]string{}
+		err  error
+	)
+
 	for len(wrkItems) > 0 {
 		item, wrkItems = trimWhiteSpace(wrkItems)
 		if item.Token == until || item.Token == TokenEOF {
@@ -277,23 +459,17 @@ func (s *Scanner) Scan() *TokenItem {
 	case eof:
 		return s.newTokenItem(TokenEOF, "")
 	case '<':
-		nextCh := s.read()
-		if isUpperCaseLetter(nextCh) {
-			s.unread()
+		// peek rather than read ahead, the reader can only unread a single rune
+		next, _ := s.r.Peek(2)
+		if len(next) > 0 && isUpperCaseLetter(rune(next[0])) {
 			// look for TagStart "<X"
 			return s.newTokenItem(TokenTagStart, string(ch))
-		} else if nextCh == '/' {
+		} else if len(next) > 1 && next[0] == '/' && isUpperCaseLetter(rune(next[1])) {
 			// look for start ClosingTag "</X"
-			nextCh = s.read()
-			s.unread()
-			if isUpperCaseLetter(nextCh) {
-				return s.newTokenItem(TokenClosingTagStart, "</")
-			}
+			s.read()
+			return s.newTokenItem(TokenClosingTagStart, "</")
 		}
 
-		if nextCh != eof {
-			s.unread()
-		}
 		return s.newTokenItem(TokenLeftAngleBracket, string(ch))
 
 	case '/':
@@ -320,6 +496,9 @@ func (s *Scanner) Scan() *TokenItem {
 		} else if nextCh == '"' {
 			return s.newTokenItem(TokenEscDoubleQuote, string(`\"`))
 		}
+		if nextCh != eof {
+			s.unread()
+		}
 		return s.newTokenItem(TokenSlash, string(ch))
 	case '`':
 		return s.newTokenItem(TokenTripleQuote, string(ch))
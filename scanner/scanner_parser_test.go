@@ -64,3 +64,154 @@ func TestScanner_ParseTagArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestScanner_ParseTagHead(t *testing.T) {
+	input := "<p>{{ if gt .N 1 }}</p>\n<Card title=\"a > b\" />\n</ Box>"
+	s := NewScanner(bytes.NewBufferString(input))
+
+	want := []*TagHead{
+		{Name: "Card", Args: map[string]string{"title": "a > b"}, IsSelfClosing: true, Start: 24, End: 46, Line: 1},
+		{Name: "Box", IsEnd: true, Start: 47, End: 54, Line: 2},
+	}
+	for _, w := range want {
+		got, err := s.ParseTagHead()
+		if err != nil {
+			t.Fatalf("Unexpected error in ParseTagHead(), gotErr = %v", err)
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("ParseTagHead() got = %+v, want %+v", got, w)
+		}
+	}
+
+	if got, err := s.ParseTagHead(); got != nil || err != nil {
+		t.Errorf("ParseTagHead() at EOF got = %+v, %v", got, err)
+	}
+}
+
+// parseTagHeads returns every tag head in input, without their offsets
+func parseTagHeads(input string) ([]*TagHead, error) {
+	s := NewScanner(bytes.NewBufferString(input))
+
+	var heads []*TagHead
+	for {
+		head, err := s.ParseTagHead()
+		if err != nil || head == nil {
+			return heads, err
+		}
+
+		head.Start, head.End, head.Line = 0, 0, 0
+		heads = append(heads, head)
+	}
+}
+
+func TestScanner_ParseTagHead_tags(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []*TagHead
+	}{
+		{
+			name: "card",
+			input: `
+			< Card arg="arg1" age="22" >
+			</Card >
+			`,
+			want: []*TagHead{
+				{Name: "Card", Args: map[string]string{"arg": "arg1", "age": "22"}},
+				{Name: "Card", IsEnd: true},
+			},
+		},
+		{
+			name: "self closing",
+			input: `
+			<InputField label="User" placeholder="e.d chidinma" help="a help message" />
+			`,
+			want: []*TagHead{
+				{Name: "InputField", Args: map[string]string{"label": "User", "placeholder": "e.d chidinma", "help": "a help message"}, IsSelfClosing: true},
+			},
+		},
+		{
+			name: "card-deck",
+			input: `
+			< Card arg="arg1" age="22" >
+				<Deck arg="arg2" ></Deck >
+			</Card>
+			<Deck arg="arg3" ></Deck>
+			`,
+			want: []*TagHead{
+				{Name: "Card", Args: map[string]string{"arg": "arg1", "age": "22"}},
+				{Name: "Deck", Args: map[string]string{"arg": "arg2"}},
+				{Name: "Deck", IsEnd: true},
+				{Name: "Card", IsEnd: true},
+				{Name: "Deck", Args: map[string]string{"arg": "arg3"}},
+				{Name: "Deck", IsEnd: true},
+			},
+		},
+		{
+			name:  "angle brackets in values",
+			input: `<Card cond="{{ if gt .N 1 }}many{{ end }}" title="a > b" /><Card title='x/>y'></Card>`,
+			want: []*TagHead{
+				{Name: "Card", Args: map[string]string{"cond": "{{ if gt .N 1 }}many{{ end }}", "title": "a > b"}, IsSelfClosing: true},
+				{Name: "Card", Args: map[string]string{"title": "x/>y"}},
+				{Name: "Card", IsEnd: true},
+			},
+		},
+		{
+			name:  "names with capitals and digits",
+			input: `<UI /><H1Card a="1"></H1Card><Btn2/>`,
+			want: []*TagHead{
+				{Name: "UI", Args: map[string]string{}, IsSelfClosing: true},
+				{Name: "H1Card", Args: map[string]string{"a": "1"}},
+				{Name: "H1Card", IsEnd: true},
+				{Name: "Btn2", Args: map[string]string{}, IsSelfClosing: true},
+			},
+		},
+		{
+			name:  "tags inside actions",
+			input: `{{ "<Card />" }}{{/* <Deck> "*/}}{{ if lt .A .B }}<Box/>{{ end }}`,
+			want: []*TagHead{
+				{Name: "Box", Args: map[string]string{}, IsSelfClosing: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTagHeads(tt.input)
+			if err != nil {
+				t.Fatalf("Unexpected error in ParseTagHead(), gotErr = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTagHead() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanner_ParseTagHead_offsets(t *testing.T) {
+	input := "<p>héllo wörld</p>\n<Card title=\"a > b\">naïve</Card>"
+	s := NewScanner(bytes.NewBufferString(input))
+
+	var got []string
+	for {
+		head, err := s.ParseTagHead()
+		if err != nil {
+			t.Fatalf("Unexpected error in ParseTagHead(), gotErr = %v", err)
+		}
+		if head == nil {
+			break
+		}
+		got = append(got, input[head.Start:head.End])
+	}
+
+	if want := []string{`<Card title="a > b">`, `</Card>`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTagHead() got = %q, want %q", got, want)
+	}
+}
+
+func TestScanner_ParseTagHead_unterminated(t *testing.T) {
+	_, err := parseTagHeads(`<Card title="a > b"`)
+	if !errors.Is(err, ErrUnterminatedTag) {
+		t.Errorf("ParseTagHead() gotErr = %v, want %v", err, ErrUnterminatedTag)
+	}
+}
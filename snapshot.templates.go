@@ -0,0 +1,177 @@
+package templates
+
+import (
+	"context"
+	"html/template"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// snapshot is a set of component and shared templates, along with the cache of templates
+// parsed against them. Reload builds a new snapshot and swaps it in, Invalidate swaps in
+// the components of a snapshot on their own
+type snapshot struct {
+	ext         string
+	funcMap     template.FuncMap
+	components  atomic.Pointer[componentSet]
+	sharedFiles []string
+	shared      map[string]fileSrc
+	// sources maps the templates parsed from the snapshot back to their files
+	sources *sourceMaps
+	strict  bool
+
+	mtx      sync.RWMutex
+	cache    map[cacheKey]*compiled
+	inflight map[cacheKey]*flight
+	deps     *depGraph
+	// strings caches the templates compiled by String
+	strings *stringCache
+}
+
+// componentSet is the component templates of a snapshot
+type componentSet struct {
+	compiled *compiled
+	// refs maps each component to the components it uses
+	refs map[string][]string
+	// legacy are the components that branch on ._isEnd
+	legacy map[string]bool
+	// ctx are the components that call ctx, directly or through the components they use
+	ctx map[string]bool
+}
+
+// lookup returns the component template name, or nil when there is none
+func (c *componentSet) lookup(name string) *template.Template {
+	if c == nil {
+		return nil
+	}
+
+	return c.compiled.tpl.Lookup(name)
+}
+
+type fileSrc struct {
+	name string
+	b    []byte
+}
+
+// snapshot returns the snapshot templates are currently rendered from
+func (t *Template) snapshot() *snapshot {
+	return t.current.Load()
+}
+
+// newSnapshot reads and parses the component and shared templates from the template root
+func (t *Template) newSnapshot() (*snapshot, error) {
+	s := &snapshot{
+		ext:      t.ext,
+		funcMap:  make(template.FuncMap, len(t.FuncMap)),
+		shared:   make(map[string]fileSrc),
+		cache:    make(map[cacheKey]*compiled),
+		inflight: make(map[cacheKey]*flight),
+		deps:     newDepGraph(),
+		sources:  newSourceMaps(),
+		strict:   t.strict,
+		strings:  newStringCache(t.stringCacheSize),
+	}
+
+	for name, fn := range t.FuncMap {
+		s.funcMap[name] = fn
+	}
+	s.funcMap["component"] = s.component
+	s.funcMap["ctx"] = backgroundCtx
+
+	readFile := readFiler(t, t.fSys)
+
+	// components templates
+	components, err := t.newComponentSet(s)
+	if err != nil {
+		return nil, err
+	}
+	s.components.Store(components)
+
+	// shared templates
+	s.sharedFiles, _ = t.findFiles(t.sharedFolder, t.ext)
+	for _, file := range s.sharedFiles {
+		name, b, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		s.shared[file] = fileSrc{name: name, b: b}
+	}
+
+	if len(s.sharedFiles) > 0 {
+		tpl, err := parseFiles(nil, s.readShared, s.funcMap, s.sources, s.sharedFiles)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.checkComponents(components, tpl); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// newComponentSet parses the templates of the component folder against s, nil when there are none
+func (t *Template) newComponentSet(s *snapshot) (*componentSet, error) {
+	if !t.isFolder(t.componentFolder) {
+		return nil, nil
+	}
+
+	filenames, _ := t.findFiles(filepath.Join(t.root, t.componentFolder), t.ext)
+	if len(filenames) == 0 {
+		return nil, nil
+	}
+
+	tpl, err := componentTemplates(filenames, s.funcMap, s.sources, readFiler(t, t.fSys))
+	if err != nil {
+		return nil, err
+	}
+
+	refs := componentRefsOf(tpl, t.ext)
+	c := &componentSet{
+		compiled: newCompiled(tpl, s),
+		refs:     refs,
+		legacy:   legacyComponents(tpl),
+		ctx:      ctxComponents(tpl, refs, t.ext),
+	}
+	if err = s.checkComponents(c, tpl); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// readShared is a readFileFunc that serves the shared templates read into the snapshot
+func (s *snapshot) readShared(file string) (string, []byte, error) {
+	src := s.shared[file]
+	// parseFiles rewrites the contents in place
+	return src.name, slices.Clone(src.b), nil
+}
+
+// Reload builds a new snapshot of the component templates, shared templates and every page,
+// and swaps it in only if everything parses. renders already in progress finish against
+// the previous snapshot, and the previous snapshot is kept when an error is returned
+func (t *Template) Reload() error {
+	return t.reload(context.Background(), true)
+}
+
+// reload builds a new snapshot, precompiling every page into it when precompile is set
+func (t *Template) reload(ctx context.Context, precompile bool) error {
+	t.reloadMtx.Lock()
+	defer t.reloadMtx.Unlock()
+
+	s, err := t.newSnapshot()
+	if err != nil {
+		return err
+	}
+
+	if precompile {
+		if err = t.precompile(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	t.current.Store(s)
+	return nil
+}
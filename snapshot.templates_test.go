@@ -0,0 +1,84 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Reload(t *testing.T) {
+	root := copyTestData(t)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "slow.tmpl"), []byte(`old {{ wait }}`), 0o644))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	reloadOptions := *options
+	reloadOptions.FuncMap = template.FuncMap{
+		"upper": options.FuncMap["upper"],
+		"wait": func() string {
+			started <- struct{}{}
+			<-release
+			return "done"
+		},
+	}
+
+	tpl, err := New(root, &reloadOptions)
+	require.NoError(t, err)
+
+	render := func(name string) (string, error) {
+		buff := bytes.NewBuffer(nil)
+		err := tpl.Render(buff, RenderOption{Template: name, Data: struct{ Name string }{Name: "philippta"}})
+		return buff.String(), err
+	}
+
+	// a render in progress finishes against the snapshot it started with
+	inFlight := make(chan string)
+	go func() {
+		out, err := render("slow")
+		assert.NoError(t, err)
+		inFlight <- out
+	}()
+	<-started
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "slow.tmpl"), []byte(`new {{ wait }}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "solo.tmpl"), []byte(`{{.Name}}, the new solo`), 0o644))
+	require.NoError(t, tpl.Reload())
+	assert.True(t, tpl.InCache("", "profile"))
+
+	release <- struct{}{}
+	assert.Equal(t, "old done", <-inFlight)
+
+	go func() { <-started; release <- struct{}{} }()
+	out, err := render("slow")
+	require.NoError(t, err)
+	assert.Equal(t, "new done", out)
+
+	out, err = render("solo")
+	require.NoError(t, err)
+	assert.Equal(t, "philippta, the new solo", out)
+
+	// a bad edit keeps the previous snapshot
+	require.NoError(t, os.WriteFile(filepath.Join(root, "solo.tmpl"), []byte(`{{.Name}}, the broken solo {{ if }}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "shared", "widgets.tmpl"), []byte(`Bye!`), 0o644))
+
+	err = tpl.Reload()
+	var pErr *PrecompileError
+	require.True(t, errors.As(err, &pErr))
+	require.Len(t, pErr.Errors, 1)
+	assert.Equal(t, filepath.Join(root, "solo.tmpl"), pErr.Errors[0].File)
+
+	out, err = render("solo")
+	require.NoError(t, err)
+	assert.Equal(t, "philippta, the new solo", out)
+
+	// shared templates are part of the snapshot, so templates parsed later still see the previous version
+	out, err = tpl.String("", `{{ template "widgets" }}`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Hey!", out)
+}
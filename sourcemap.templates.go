@@ -0,0 +1,243 @@
+package templates
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// srcSpan maps the output starting at out to the source starting at src. the output is copied
+// from the source up to the next span, unless tag is set, when it was generated from tag
+type srcSpan struct {
+	out int
+	src int
+	tag *Tag
+}
+
+// sourceBuffer is a buffer that records where each part of its contents came from
+type sourceBuffer struct {
+	bytes.Buffer
+	spans []srcSpan
+}
+
+// writeSrc writes p, found at offset at in the source
+func (b *sourceBuffer) writeSrc(p []byte, at int) {
+	b.writeSpan(p, srcSpan{src: at}, 0)
+}
+
+// writeGen writes s, generated from tag
+func (b *sourceBuffer) writeGen(s string, tag *Tag) {
+	b.writeSpan([]byte(s), srcSpan{src: tag.loc[0], tag: tag}, 0)
+}
+
+// writeSpan writes p, found off bytes into span
+func (b *sourceBuffer) writeSpan(p []byte, span srcSpan, off int) {
+	if len(p) == 0 {
+		return
+	}
+	if span.tag == nil {
+		span.src += off
+	}
+
+	span.out = b.Len()
+	b.spans = append(b.spans, span)
+	b.Write(p)
+}
+
+// writeBuf writes the contents of o along with its spans
+func (b *sourceBuffer) writeBuf(o *sourceBuffer) {
+	shift := b.Len()
+	for _, span := range o.spans {
+		span.out += shift
+		b.spans = append(b.spans, span)
+	}
+	b.Write(o.Bytes())
+}
+
+// each calls fn with the contents of every span
+func (b *sourceBuffer) each(fn func(p []byte, span srcSpan)) {
+	out := b.Bytes()
+	for i, span := range b.spans {
+		end := len(out)
+		if i+1 < len(b.spans) {
+			end = b.spans[i+1].out
+		}
+		fn(out[span.out:end], span)
+	}
+}
+
+// sourceMap maps positions in a template rewritten by rewriteComponents back to its file
+type sourceMap struct {
+	file  string
+	src   []byte
+	spans []srcSpan
+	// lines holds the offset of every line in the rewritten template
+	lines []int
+	// body is where the blocks moved out from between component tags start in the rewritten template
+	body int
+}
+
+func newSourceMap(file string, src, out []byte, spans []srcSpan) *sourceMap {
+	m := &sourceMap{file: file, src: src, spans: spans, lines: []int{0}, body: len(out)}
+	for i, c := range out {
+		if c == '\n' {
+			m.lines = append(m.lines, i+1)
+		}
+	}
+
+	for _, span := range spans {
+		if span.tag != nil && bytes.HasPrefix(out[span.out:], []byte(blockDefine)) {
+			m.body = span.out
+			break
+		}
+	}
+
+	return m
+}
+
+// locate returns the position in the file of line and col (-1 when unknown) of the rewritten
+// template, along with the tag the text at that position was generated from
+func (m *sourceMap) locate(line, col int) (srcLine, srcCol int, tag *Tag) {
+	if line < 1 || line > len(m.lines) {
+		return line, col, nil
+	}
+
+	offset := m.lines[line-1]
+	if col > 0 {
+		offset += col
+	}
+	i := sort.Search(len(m.spans), func(i int) bool { return m.spans[i].out > offset }) - 1
+	if i < 0 {
+		return line, col, nil
+	}
+
+	pos := m.spans[i].src + offset - m.spans[i].out
+	if tag = m.spans[i].tag; tag != nil {
+		pos = m.spans[i].src
+	} else if col < 0 {
+		// only the line is known, look for a tag on the line. the blocks follow the last line of the body
+		// on the same line, and are not part of it
+		end := -1
+		if line < len(m.lines) {
+			end = m.lines[line]
+		}
+		if offset < m.body && (end < 0 || end > m.body) {
+			end = m.body
+		}
+		for _, span := range m.spans[i:] {
+			if end >= 0 && span.out >= end {
+				break
+			}
+			if span.tag != nil {
+				tag = span.tag
+				break
+			}
+		}
+	}
+
+	srcLine = 1 + bytes.Count(m.src[:pos], []byte("\n"))
+	srcCol = pos - (bytes.LastIndexByte(m.src[:pos], '\n') + 1)
+	return srcLine, srcCol, tag
+}
+
+// sourceMaps holds the source map of every template file parsed from a snapshot, by template name
+type sourceMaps struct {
+	mtx  sync.RWMutex
+	maps map[string]*sourceMap
+}
+
+func newSourceMaps() *sourceMaps {
+	return &sourceMaps{maps: make(map[string]*sourceMap)}
+}
+
+func (m *sourceMaps) set(name string, sm *sourceMap) {
+	if m == nil {
+		return
+	}
+
+	m.mtx.Lock()
+	m.maps[name] = sm
+	m.mtx.Unlock()
+}
+
+func (m *sourceMaps) get(name string) *sourceMap {
+	if m == nil {
+		return nil
+	}
+
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.maps[name]
+}
+
+func (m *sourceMaps) delete(name string) {
+	if m == nil {
+		return
+	}
+
+	m.mtx.Lock()
+	delete(m.maps, name)
+	m.mtx.Unlock()
+}
+
+// reErrLocation matches the template locations in parse and exec errors e.g. "template: profile:3:12"
+var reErrLocation = regexp.MustCompile(`(html/template:|template: )([^\s:]+):(\d+)(?::(\d+))?`)
+
+// rewrite maps the template locations in the message of err back to the template files
+func (m *sourceMaps) rewrite(err error) error {
+	return rewriteError(err, m.get)
+}
+
+// sourceError is an error with the template locations in its message mapped back to the template files
+type sourceError struct {
+	msg string
+	err error
+}
+
+func (e *sourceError) Error() string {
+	return e.msg
+}
+
+func (e *sourceError) Unwrap() error {
+	return e.err
+}
+
+func rewriteError(err error, lookup func(name string) *sourceMap) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	rewritten := reErrLocation.ReplaceAllStringFunc(msg, func(loc string) string {
+		m := reErrLocation.FindStringSubmatch(loc)
+		sm := lookup(m[2])
+		if sm == nil {
+			return loc
+		}
+
+		line, _ := strconv.Atoi(m[3])
+		col := -1
+		if m[4] != "" {
+			col, _ = strconv.Atoi(m[4])
+		}
+
+		line, col, tag := sm.locate(line, col)
+		loc = m[1] + sm.file + ":" + strconv.Itoa(line)
+		if m[4] != "" {
+			loc += ":" + strconv.Itoa(col)
+		}
+		if tag != nil {
+			loc += ": in " + string(sm.src[tag.loc[0]:tag.loc[1]])
+		}
+
+		return loc
+	})
+
+	if rewritten == msg {
+		return err
+	}
+
+	return &sourceError{msg: rewritten, err: err}
+}
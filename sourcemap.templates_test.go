@@ -0,0 +1,45 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceMapErrors(t *testing.T) {
+	tpl := newMapFSTemplate(t, map[string]string{
+		"map-parse.tmpl": "<p>intro</p>\n<Panel title=\"x\">\n\tbody\n</Panel>\n{{ if }}\n",
+		"map-body.tmpl":  "<p>intro</p>\n<Panel title=\"x\">\n\t{{ .Missing }}\n</Panel>\n",
+		"map-last.tmpl":  "<p>intro</p>\n<Panel title=\"x\">body</Panel>\n{{ if }}",
+		"map-tag.tmpl":   "<p>intro</p>\n<Panel title=\"x\"></Panel>\n  <Panel title=\"{{ .Missing }}\" />\n",
+	})
+
+	render := func(name string) error {
+		return tpl.Render(bytes.NewBuffer(nil), RenderOption{Template: name, Data: struct{ Name string }{}})
+	}
+
+	// the panel body is moved out of the way, so the if is on line 3 of the rewritten template
+	err := render("map-parse")
+	assert.EqualError(t, err, "template: testData/map-parse.tmpl:5: missing value for if")
+
+	// the blocks moved out of the panel follow the last line, which is not part of the panel
+	err = render("map-last")
+	assert.EqualError(t, err, "template: testData/map-last.tmpl:3: missing value for if")
+
+	// errors in a body are reported where the body was written, along with the call that rendered it
+	err = render("map-body")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `template: testData/map-body.tmpl:2:0: in <Panel title="x">: executing "map-body"`)
+	assert.Contains(t, err.Error(), `template: testData/map-body.tmpl:3:4: executing "_map-body:panel:1" at <.Missing>`)
+
+	var execErr template.ExecError
+	assert.True(t, errors.As(err, &execErr))
+
+	// errors in the arguments of a tag are reported at the tag
+	err = render("map-tag")
+	assert.EqualError(t, err, `template: testData/map-tag.tmpl:3:2: in <Panel title="{{ .Missing }}" />: executing "map-tag" at <.Missing>: can't evaluate field Missing in type struct { Name string }`)
+}
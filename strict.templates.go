@@ -0,0 +1,70 @@
+package templates
+
+import (
+	"errors"
+	"html/template"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+var errUnknownComponent = errors.New("unknown component")
+
+// checkComponents returns a *ComponentError for the first call in tpl to a component that does
+// not exist in components, when the snapshot is strict
+func (s *snapshot) checkComponents(components *componentSet, tpl *template.Template) error {
+	if !s.strict {
+		return nil
+	}
+
+	templates := tpl.Templates()
+	slices.SortFunc(templates, func(a, b *template.Template) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	for _, tmpl := range templates {
+		if tmpl.Tree == nil {
+			continue
+		}
+
+		var err error
+		walkNodes(tmpl.Tree.Root, func(cmd *parse.CommandNode) {
+			name, ok := componentName(cmd)
+			if err == nil && ok && components.lookup(name+s.ext) == nil {
+				err = s.unknownComponent(tmpl.Tree, cmd, name)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var reNodeLocation = regexp.MustCompile(`:(\d+):(\d+)$`)
+
+// unknownComponent returns the error for cmd calling the unknown component name,
+// located in the template file using the source maps of the snapshot
+func (s *snapshot) unknownComponent(tree *parse.Tree, cmd *parse.CommandNode, name string) error {
+	cErr := &ComponentError{Component: name, Err: errUnknownComponent}
+
+	loc, _ := tree.ErrorContext(cmd)
+	m := reNodeLocation.FindStringSubmatch(loc)
+	sm := s.sources.get(tree.ParseName)
+	if m == nil || sm == nil {
+		return cErr
+	}
+
+	line, _ := strconv.Atoi(m[1])
+	col, _ := strconv.Atoi(m[2])
+	line, _, tag := sm.locate(line, col)
+	cErr.File, cErr.Line = sm.file, line
+	if tag != nil {
+		cErr.Component = tag.Name
+	}
+
+	return cErr
+}
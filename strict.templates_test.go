@@ -0,0 +1,63 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrict(t *testing.T) {
+	files := map[string]string{
+		"typo.tmpl":              "<p>\n  <Crad title=\"x\" />\n</p>",
+		"broken-comp.tmpl":       `<Broken />`,
+		"components/broken.tmpl": `{{ index .list 5 }}`,
+	}
+
+	render := func(tpl *Template, name string) (string, error) {
+		buff := bytes.NewBuffer(nil)
+		err := tpl.Render(buff, RenderOption{Template: name})
+		return buff.String(), err
+	}
+
+	tpl := newMapFSTemplate(t, files)
+
+	// unknown components render nothing and errors are rendered in place
+	out, err := render(tpl, "typo")
+	require.NoError(t, err)
+	assert.Equal(t, "<p>\n  \n</p>", out)
+
+	out, err = render(tpl, "broken-comp")
+	require.NoError(t, err)
+	assert.Contains(t, out, "error calling index")
+
+	fsOptions := mapFSOptions(t, files)
+	fsOptions.Strict = true
+	tpl, err = New("./testData", fsOptions)
+	require.NoError(t, err)
+
+	var cErr *ComponentError
+	_, err = render(tpl, "typo")
+	require.True(t, errors.As(err, &cErr))
+	assert.Equal(t, "Crad", cErr.Component)
+	assert.Equal(t, "testData/typo.tmpl", cErr.File)
+	assert.Equal(t, 2, cErr.Line)
+	assert.ErrorIs(t, err, errUnknownComponent)
+
+	_, err = render(tpl, "broken-comp")
+	require.True(t, errors.As(err, &cErr))
+	assert.Equal(t, "broken", cErr.Component)
+	assert.Equal(t, "testData/components/broken.tmpl", cErr.File)
+	assert.Contains(t, err.Error(), "error calling index")
+
+	// components are checked when the templates are loaded
+	files["components/outer.tmpl"] = `<Inner />`
+	fsOptions = mapFSOptions(t, files)
+	fsOptions.Strict = true
+	_, err = New("./testData", fsOptions)
+	require.True(t, errors.As(err, &cErr))
+	assert.Equal(t, "Inner", cErr.Component)
+	assert.Equal(t, "testData/components/outer.tmpl", cErr.File)
+}
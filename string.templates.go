@@ -0,0 +1,157 @@
+package templates
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// DefaultStringCacheSize is the number of templates rendered from source that are cached
+// when TemplateOptions.StringCacheSize is not set
+const DefaultStringCacheSize = 1000
+
+// stringFile stands for the source of a template rendered from source in the list of files
+// it is parsed from, see RenderOption.RenderString
+const stringFile = "<string>"
+
+// inlineSource is a template rendered from its source. it is parsed under name, which is unique
+// to the source and the templates it is rendered with
+type inlineSource struct {
+	name string
+	src  []byte
+}
+
+func newInlineSource(option RenderOption) *inlineSource {
+	h := sha256.New()
+	for _, s := range append([]string{option.Layout, option.Template}, option.Others...) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	return &inlineSource{name: "string-" + hex.EncodeToString(h.Sum(nil)[:16]), src: []byte(option.Template)}
+}
+
+// readFiler returns a readFileFunc serving the source as stringFile, and reading other files with readFile
+func (in *inlineSource) readFiler(readFile readFileFunc) readFileFunc {
+	return func(file string) (string, []byte, error) {
+		if in != nil && file == stringFile {
+			return in.name, in.src, nil
+		}
+
+		return readFile(file)
+	}
+}
+
+// inlineRelatedFiles is getRelatedFiles for the source
+func (t *Template) inlineRelatedFiles(in *inlineSource) []string {
+	files := []string{stringFile}
+	for _, ref := range templateRefs(in.src) {
+		if file := t.absTemplateName(ref); t.pathExists(file) {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+// getString returns the template for the source in option.Template cached in s, parsing it on a cache miss
+func (t *Template) getString(s *snapshot, option RenderOption) (*compiled, error) {
+	inline := newInlineSource(option)
+	if !t.Debug {
+		if c := s.strings.get(newCacheKey(option.Layout, inline.name, option.Others)); c != nil {
+			return c, nil
+		}
+	}
+
+	return t.compile(s, option.Layout, stringFile, option.Others, inline)
+}
+
+// cacheString stores tpl in the string cache of s, dropping the dependencies of the templates it evicts
+func (s *snapshot) cacheString(key cacheKey, c *compiled) {
+	for _, evicted := range s.strings.add(key, c) {
+		s.mtx.Lock()
+		s.deps.remove(evicted)
+		s.mtx.Unlock()
+		s.sources.delete(evicted.name)
+	}
+}
+
+type stringEntry struct {
+	key cacheKey
+	tpl *compiled
+}
+
+// stringCache holds the templates rendered from source, evicting the least recently used
+// once it holds size templates
+type stringCache struct {
+	mtx   sync.Mutex
+	size  int
+	order *list.List
+	items map[cacheKey]*list.Element
+}
+
+func newStringCache(size int) *stringCache {
+	return &stringCache{size: size, order: list.New(), items: make(map[cacheKey]*list.Element)}
+}
+
+func (c *stringCache) get(key cacheKey) *compiled {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, found := c.items[key]
+	if !found {
+		return nil
+	}
+
+	c.order.MoveToFront(e)
+	return e.Value.(*stringEntry).tpl
+}
+
+// add stores tpl under key, and returns the keys evicted to make room for it
+func (c *stringCache) add(key cacheKey, tpl *compiled) []cacheKey {
+	if c.size <= 0 {
+		return []cacheKey{key}
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if e, found := c.items[key]; found {
+		e.Value.(*stringEntry).tpl = tpl
+		c.order.MoveToFront(e)
+		return nil
+	}
+
+	var evicted []cacheKey
+	c.items[key] = c.order.PushFront(&stringEntry{key: key, tpl: tpl})
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(*stringEntry).key)
+		evicted = append(evicted, e.Value.(*stringEntry).key)
+	}
+
+	return evicted
+}
+
+// remove removes key, reporting whether it was cached
+func (c *stringCache) remove(key cacheKey) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, found := c.items[key]
+	if found {
+		c.order.Remove(e)
+		delete(c.items, key)
+	}
+
+	return found
+}
+
+func (c *stringCache) len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.order.Len()
+}
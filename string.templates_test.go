@@ -0,0 +1,165 @@
+package templates
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestString_components(t *testing.T) {
+	mfs := fstest.MapFS{
+		"site/base.tmpl":            {Data: []byte(`<main>{{ block "content" . }}{{ end }}</main>`)},
+		"site/components/card.tmpl": {Data: []byte(`<div class="card"><h1>{{ .title }}</h1>{{ .children }}</div>`)},
+	}
+	tpl, err := New("site", &TemplateOptions{FS: mfs})
+	require.NoError(t, err)
+
+	out, err := tpl.String("", `<Card title="{{ .Title }}"><p>{{ .Body }}</p></Card>`, map[string]any{"Title": "news", "Body": "today"})
+	require.NoError(t, err)
+	assert.Equal(t, `<div class="card"><h1>news</h1><p>today</p></div>`, out)
+
+	out, err = tpl.String("base", `{{ define "content" }}<Card title="in a layout" />{{ end }}`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `<main><div class="card"><h1>in a layout</h1></div></main>`, out)
+
+	_, err = tpl.String("", `</Card>`, nil)
+	var cErr *ComponentError
+	require.ErrorAs(t, err, &cErr)
+	assert.Equal(t, "Card", cErr.Component)
+}
+
+func TestString_cache(t *testing.T) {
+	mfs := fstest.MapFS{
+		"site/base.tmpl": {Data: []byte(`<main>{{ block "content" . }}{{ end }}</main>`)},
+	}
+	tpl, err := New("site", &TemplateOptions{FS: mfs, StringCacheSize: 2})
+	require.NoError(t, err)
+
+	s := tpl.snapshot()
+	render := func(layout, src string) string {
+		out, err := tpl.String(layout, src, "x")
+		require.NoError(t, err)
+		return out
+	}
+	cached := func(layout, src string) bool {
+		return tpl.InCacheOption(RenderOption{Layout: layout, Template: src, RenderString: true})
+	}
+
+	assert.Equal(t, "a x", render("", `a {{ . }}`))
+	first := s.strings.get(keyOf(RenderOption{Template: `a {{ . }}`, RenderString: true}))
+	require.NotNil(t, first)
+	assert.Equal(t, "a x", render("", `a {{ . }}`))
+	assert.Same(t, first, s.strings.get(keyOf(RenderOption{Template: `a {{ . }}`, RenderString: true})))
+
+	// the same source in another layout is compiled apart
+	content := `{{ define "content" }}a {{ . }}{{ end }}`
+	assert.Equal(t, "<main>a x</main>", render("base", content))
+	assert.Equal(t, 2, s.strings.len())
+
+	// the least recently used template is evicted, along with its dependencies
+	render("", `a {{ . }}`)
+	assert.Equal(t, "b x", render("", `b {{ . }}`))
+	assert.Equal(t, 2, s.strings.len())
+	assert.True(t, cached("", `a {{ . }}`))
+	assert.False(t, cached("base", content))
+	assert.Empty(t, tpl.Dependents("base"))
+
+	// editing the layout evicts the templates rendered in it
+	render("base", `{{ define "content" }}c{{ end }}`)
+	assert.Equal(t, []RenderOption{{Layout: "base", Template: `{{ define "content" }}c{{ end }}`, RenderString: true}}, tpl.Dependents("base"))
+	mfs["site/base.tmpl"] = &fstest.MapFile{Data: []byte(`<article>{{ block "content" . }}{{ end }}</article>`)}
+	require.NoError(t, tpl.Invalidate("base"))
+	assert.False(t, cached("base", `{{ define "content" }}c{{ end }}`))
+	assert.Equal(t, "<article>c</article>", render("base", `{{ define "content" }}c{{ end }}`))
+}
+
+func TestString_noCache(t *testing.T) {
+	tpl, err := New("site", &TemplateOptions{FS: fstest.MapFS{"site/index.tmpl": {Data: []byte(`home`)}}, StringCacheSize: -1})
+	require.NoError(t, err)
+
+	out, err := tpl.String("", `{{ . }}`, "hi")
+	require.NoError(t, err)
+	assert.Equal(t, "hi", out)
+	assert.Equal(t, 0, tpl.snapshot().strings.len())
+}
+
+func BenchmarkString(b *testing.B) {
+	mfs := fstest.MapFS{
+		"site/base.tmpl":            {Data: []byte(`<main>{{ block "content" . }}{{ end }}</main>`)},
+		"site/components/card.tmpl": {Data: []byte(`<div class="card">{{ .children }}</div>`)},
+	}
+	tpl, err := New("site", &TemplateOptions{FS: mfs})
+	require.NoError(b, err)
+
+	src := `{{ define "content" }}<Card><p>{{ . }}</p></Card>{{ end }}`
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err = tpl.String("base", src, "snippet"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRender_renderString(t *testing.T) {
+	mfs := fstest.MapFS{
+		"site/base.tmpl":            {Data: []byte(`<main>{{ block "content" . }}{{ end }}{{ block "aside" . }}{{ end }}</main>`)},
+		"site/aside.tmpl":           {Data: []byte(`{{ define "aside" }}<aside>{{ . }}</aside>{{ end }}`)},
+		"site/footer.tmpl":          {Data: []byte(`<footer>{{ . }}</footer>`)},
+		"site/shared/hello.tmpl":    {Data: []byte(`{{ define "hello" }}hello {{ . }}{{ end }}`)},
+		"site/components/card.tmpl": {Data: []byte(`<div class="card">{{ .children }}</div>`)},
+	}
+	tpl, err := New("site", &TemplateOptions{FS: mfs})
+	require.NoError(t, err)
+
+	render := func(option RenderOption) (string, error) {
+		out := new(bytes.Buffer)
+		option.RenderString, option.Data = true, "x"
+		err := tpl.Render(out, option)
+		return out.String(), err
+	}
+
+	tests := []struct {
+		name   string
+		option RenderOption
+		want   string
+	}{
+		{"source", RenderOption{Template: `<Card>{{ template "hello" . }}</Card>`}, `<div class="card">hello x</div>`},
+		{"layout and others", RenderOption{Layout: "base", Template: `{{ define "content" }}c{{ end }}`, Others: []string{"aside"}}, `<main>c<aside>x</aside></main>`},
+		{"extends", RenderOption{Template: `{{/* extends "base" */}}{{ define "content" }}e{{ end }}`}, `<main>e</main>`},
+		{"references", RenderOption{Template: `{{ template "footer" . }}`}, `<footer>x</footer>`},
+		{"fragment", RenderOption{Layout: "base", Template: `{{ define "content" }}<Card>f</Card>{{ end }}`, Fragment: "content"}, `<div class="card">f</div>`},
+		{"buffered", RenderOption{Template: `b`, Buffered: true}, `b`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := render(tt.option)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	_, err = render(RenderOption{Layout: "missing", Template: `hi`})
+	var lErr *LayoutNotFoundError
+	require.ErrorAs(t, err, &lErr)
+	assert.Equal(t, "missing", lErr.Layout)
+
+	// errors point into the source
+	_, err = render(RenderOption{Template: "line\n{{ index . 5 }}"})
+	assert.ErrorContains(t, err, "template: <string>:2:3: executing")
+
+	_, err = render(RenderOption{Template: "line\n<Card>{{ if }}</Card>"})
+	assert.ErrorContains(t, err, "template: <string>:2: in <Card>: missing value for if")
+
+	_, err = render(RenderOption{Template: "</Card>"})
+	var cErr *ComponentError
+	require.ErrorAs(t, err, &cErr)
+	assert.Equal(t, "<string>", cErr.File)
+
+	// a source is never taken for a template name
+	out, err := render(RenderOption{Template: `footer`})
+	require.NoError(t, err)
+	assert.Equal(t, "footer", out)
+}
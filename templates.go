@@ -2,14 +2,17 @@ package templates
 
 import (
 	"bytes"
+	"context"
 	"errors"
-	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
-	"strings"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Template struct {
@@ -18,12 +21,17 @@ type Template struct {
 	sharedFolder string
 	FuncMap      template.FuncMap
 
-	cache              map[string]*template.Template
-	mtx                sync.RWMutex
-	Debug              bool
-	fSys               fs.FS
-	componentFolder    string
-	componentTemplates *template.Template
+	current         atomic.Pointer[snapshot]
+	reloadMtx       sync.Mutex
+	Debug           bool
+	fSys            fs.FS
+	componentFolder string
+	stopWatch       chan struct{}
+	strict          bool
+	stringCacheSize int
+
+	loadersMtx sync.RWMutex
+	loaders    map[string]Loader
 }
 
 type TemplateOptions struct {
@@ -31,6 +39,16 @@ type TemplateOptions struct {
 	FuncMap   template.FuncMap
 	PathToSVG string
 	FS        fs.FS
+	// Watch polls the template root for changes and evicts stale cache entries
+	Watch bool
+	// WatchInterval is the polling interval used when Watch is set, defaults to 1 second
+	WatchInterval time.Duration
+	// Strict fails parsing templates that use unknown components,
+	// and fails renders when a component fails to execute
+	Strict bool
+	// StringCacheSize is the number of templates rendered from source that are cached,
+	// defaults to DefaultStringCacheSize. a negative size disables the cache
+	StringCacheSize int
 }
 
 func New(root string, options *TemplateOptions) (*Template, error) {
@@ -46,7 +64,14 @@ func New(root string, options *TemplateOptions) (*Template, error) {
 		}
 	}
 
-	t.fSys = options.FS
+	if options.FS != nil {
+		t.fSys, err = fs.Sub(options.FS, filepath.ToSlash(filepath.Clean(root)))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		t.fSys = os.DirFS(root)
+	}
 
 	// default to .tmpl when none is provided
 	if options.Ext == "" {
@@ -58,9 +83,12 @@ func New(root string, options *TemplateOptions) (*Template, error) {
 		t.ext = "." + options.Ext
 	}
 
-	t.cache = make(map[string]*template.Template)
-
 	t.sharedFolder = filepath.Join(t.root, "shared")
+	t.strict = options.Strict
+	t.stringCacheSize = options.StringCacheSize
+	if t.stringCacheSize == 0 {
+		t.stringCacheSize = DefaultStringCacheSize
+	}
 	if err = t.init(); err != nil {
 		return nil, err
 	}
@@ -69,15 +97,16 @@ func New(root string, options *TemplateOptions) (*Template, error) {
 		return nil, err
 	}
 
-	// components templates
+	// components and shared templates
 	t.componentFolder = "components"
-	if t.isFolder(t.componentFolder) {
-		componentFolder := filepath.Join(t.root, t.componentFolder)
-		t.componentTemplates, err = componentTemplates(componentFolder, t.ext, t.FuncMap, readFiler(t, t.fSys))
-		if err != nil && !strings.Contains(err.Error(), "pattern matches no files") {
-			return nil, err
-		}
+	if err = t.reload(context.Background(), false); err != nil {
+		return nil, err
+	}
+
+	if options.Watch {
+		t.watch(options.WatchInterval)
 	}
+
 	return t, nil
 }
 
@@ -86,102 +115,200 @@ func (t *Template) init() error {
 }
 
 type RenderOption struct {
-	Layout       string
-	Template     string
+	Layout   string
+	Template string
+	// RenderString renders Template as the source of a template rather than its name, parsed along with
+	// Layout, Others, shared templates and components like a template file. templates rendered from
+	// source are cached by their source, see TemplateOptions.StringCacheSize
 	RenderString bool
 	Others       []string
 	Data         any
+	// Fragment is the name of a block or defined template to render instead of the whole template,
+	// e.g. "content" for htmx partial responses
+	Fragment string
+	// Buffered renders into a buffer that is copied to the writer only when rendering succeeds,
+	// so nothing is written when it fails
+	Buffered bool
+	// Funcs replace funcs of the FuncMap for this render only, e.g. a csrfToken for the request, in the
+	// template and the components it uses. they are bound to a clone of the cached template, which is not
+	// parsed again. each func must be declared in TemplateOptions.FuncMap for templates to parse
+	Funcs template.FuncMap
 }
 
+// Render renders option to out. when option.Data is nil the data is loaded by the loader
+// registered for option.Template, see Load
 func (t *Template) Render(out io.Writer, option RenderOption) error {
-	return t.renderFiles(out, option.Layout, option.Template, option.Data, option.Others)
+	return t.RenderContext(context.Background(), out, option)
 }
 
 var ErrNoTemplates = errors.New("no templates")
 
-func (t *Template) renderFiles(out io.Writer, layout, name string, data any, others []string) error {
+func (t *Template) renderFiles(ctx context.Context, out io.Writer, option RenderOption) error {
+	s := t.snapshot()
+	c, err := t.templateFor(s, option)
+	if err != nil {
+		return err
+	}
+
+	inst, err := c.get(ctx, option.Funcs)
+	if err != nil {
+		return err
+	}
+	defer c.put(inst)
+
+	if !option.Buffered {
+		return s.sources.rewrite(execute(ctx, inst.tpl, out, option))
+	}
+
+	buff := getBuffer()
+	defer putBuffer(buff)
+	if err = execute(ctx, inst.tpl, buff, option); err != nil {
+		return s.sources.rewrite(err)
+	}
+
+	_, err = buff.WriteTo(out)
+	return err
+}
+
+// execute executes option.Fragment from tpl when set, or tpl itself. writing stops once ctx is done,
+// and ctx.Err() is returned
+func execute(ctx context.Context, tpl *template.Template, out io.Writer, option RenderOption) error {
+	if ctx.Done() != nil {
+		out = &limitWriter{ctx: ctx, w: out}
+	}
+
+	var err error
+	if option.Fragment != "" {
+		err = tpl.ExecuteTemplate(out, option.Fragment, option.Data)
+	} else {
+		err = tpl.Execute(out, option.Data)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
+
+// templateFor returns the template option renders from s
+func (t *Template) templateFor(s *snapshot, option RenderOption) (*compiled, error) {
+	if option.RenderString {
+		return t.getString(s, option)
+	}
+
+	return t.getTemplate(s, option.Layout, option.Template, option.Others)
+}
+
+// getTemplate returns the template for layout and name cached in s, parsing it on a cache miss
+func (t *Template) getTemplate(s *snapshot, layout, name string, others []string) (*compiled, error) {
 	var (
-		err   error
 		found bool
-		tpl   *template.Template
+		c     *compiled
 	)
 
 	if layout == "" && name == "" {
-		return ErrNoTemplates
+		return nil, ErrNoTemplates
 	}
 
-	var templates []string
-
-	baseTpl := fmt.Sprint("noLayout", "-", name)
-	if layout != "" {
-		baseTpl = fmt.Sprint(layout, "-", name)
+	if !t.Debug {
+		s.mtx.RLock()
+		c, found = s.cache[newCacheKey(layout, name, others)]
+		s.mtx.RUnlock()
 	}
 
-	if !t.Debug {
-		t.mtx.RLock()
-		tpl, found = t.cache[baseTpl]
-		t.mtx.RUnlock()
+	if found {
+		return c, nil
 	}
 
-	if !found {
-		templates = append([]string{name}, others...)
+	return t.compileOnce(s, layout, name, others)
+}
 
-		// put layout first if provided
-		if layout != "" {
-			templates = append([]string{layout}, templates...)
-		}
+// flight is a parse shared by concurrent cache misses for the same key
+type flight struct {
+	wg  sync.WaitGroup
+	c   *compiled
+	err error
+}
 
-		// expand the first entry in templates if it includes multiple files
-		tpl, err = t.parse(templates...)
-		if err != nil {
-			return err
-		}
+// compileOnce compiles layout, name and others, making concurrent callers for the same
+// key wait for a single parse and share its result
+func (t *Template) compileOnce(s *snapshot, layout, name string, others []string) (*compiled, error) {
+	key := newCacheKey(layout, name, others)
 
-		t.mtx.Lock()
-		t.cache[baseTpl] = tpl
-		t.mtx.Unlock()
+	s.mtx.Lock()
+	if c, found := s.cache[key]; found && !t.Debug {
+		s.mtx.Unlock()
+		return c, nil
 	}
 
-	return tpl.Execute(out, data)
+	if f, found := s.inflight[key]; found {
+		s.mtx.Unlock()
+		f.wg.Wait()
+		return f.c, f.err
+	}
+
+	f := new(flight)
+	f.wg.Add(1)
+	s.inflight[key] = f
+	s.mtx.Unlock()
+
+	f.c, f.err = t.compile(s, layout, name, others, nil)
+	f.wg.Done()
+
+	s.mtx.Lock()
+	delete(s.inflight, key)
+	s.mtx.Unlock()
+
+	return f.c, f.err
 }
 
-func (t *Template) String(layout, src string, data any) (string, error) {
-	var (
-		err error
-		tpl *template.Template
-	)
+// compile parses layout, name and others then stores the result in the cache of s.
+// name is stringFile when rendering inline, which is stored in the string cache of s
+func (t *Template) compile(s *snapshot, layout, name string, others []string, inline *inlineSource) (*compiled, error) {
+	templates := append([]string{name}, others...)
 
+	// put layout first if provided
 	if layout != "" {
-		layoutFleName := filepath.Join(t.root, layout+t.ext)
-		tpl, err = t.parseFiles(nil, readFiler(t, t.fSys), layoutFleName)
-		if err != nil {
-			return "", err
-		}
+		templates = append([]string{layout}, templates...)
+	}
 
-		tpl, err = tpl.Parse(src)
-		if err != nil {
-			return "", err
-		}
-	} else {
-		tpl, err = template.New("").Funcs(t.FuncMap).Parse(src)
-		if err != nil {
-			return "", err
-		}
+	// expand the first entry in templates if it includes multiple files
+	tpl, files, err := t.parse(s, inline, templates...)
+	var nfErr *TemplateNotFoundError
+	if layout != "" && errors.As(err, &nfErr) && nfErr.Name == layout {
+		return nil, &LayoutNotFoundError{Template: name, Layout: layout}
+	} else if err != nil {
+		return nil, err
 	}
 
-	filenames, _ := t.findFiles(t.sharedFolder, t.ext)
-	if err != nil {
-		return "", err
+	key := newCacheKey(layout, name, others)
+	option := RenderOption{Layout: layout, Template: name, Others: others}
+	if inline != nil {
+		key.name = inline.name
+		option.Template, option.RenderString = string(inline.src), true
+		files = slices.DeleteFunc(files, func(file string) bool { return file == stringFile })
 	}
 
-	if len(filenames) > 0 {
-		if tpl, err = t.parseFiles(tpl, readFiler(t, t.fSys), filenames...); err != nil {
-			return "", err
-		}
+	c := newCompiled(tpl, s)
+	files = t.templateDeps(s, tpl, files)
+	s.mtx.Lock()
+	if inline == nil {
+		s.cache[key] = c
 	}
+	s.deps.add(key, option, files)
+	s.mtx.Unlock()
 
+	if inline != nil {
+		s.cacheString(key, c)
+	}
+
+	return c, nil
+}
+
+// String renders src in layout (when set) with data, see RenderOption.RenderString
+func (t *Template) String(layout, src string, data any) (string, error) {
 	out := bytes.NewBufferString("")
-	err = tpl.Execute(out, data)
+	err := t.Render(out, RenderOption{Layout: layout, Template: src, RenderString: true, Data: data})
 	if err != nil {
 		return "", err
 	}
@@ -3,8 +3,14 @@ package templates
 import (
 	"bytes"
 	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -48,7 +54,7 @@ func Test_templateCache(t *testing.T) {
 	d := struct{ Name string }{Name: "philippta"}
 	err = tpl.Render(buff, RenderOption{Layout: "", Template: "profile", Data: d})
 	require.NoError(t, err)
-	assert.Contains(t, tpl.cache, "noLayout-profile")
+	assert.Contains(t, tpl.snapshot().cache, newCacheKey("", "profile", nil))
 
 	tpl, err = New("./testData", options)
 	require.NoError(t, err)
@@ -56,7 +62,7 @@ func Test_templateCache(t *testing.T) {
 	tpl.Debug = true
 	err = tpl.Render(buff, RenderOption{Layout: "", Template: "profile", Data: d})
 	require.NoError(t, err)
-	assert.Contains(t, tpl.cache, "noLayout-profile")
+	assert.Contains(t, tpl.snapshot().cache, newCacheKey("", "profile", nil))
 }
 
 func Test__noTemplate(t *testing.T) {
@@ -301,3 +307,270 @@ func Test_SpecifyDyanmicLayout(t *testing.T) {
 		buff.String(),
 	)
 }
+
+func loadMapFS(t *testing.T, root string) fstest.MapFS {
+	t.Helper()
+
+	mfs := fstest.MapFS{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		mfs[filepath.ToSlash(filepath.Clean(path))] = &fstest.MapFile{Data: b}
+		return nil
+	})
+	require.NoError(t, err)
+
+	return mfs
+}
+
+// mapFSOptions returns options reading testData from a MapFS, with the files of extra added to it.
+// extra is keyed by the path of each file within testData e.g. "components/broken.tmpl"
+func mapFSOptions(t *testing.T, extra map[string]string) *TemplateOptions {
+	t.Helper()
+
+	mfs := loadMapFS(t, "testData")
+	for name, src := range extra {
+		mfs["testData/"+name] = &fstest.MapFile{Data: []byte(src)}
+	}
+
+	fsOptions := *options
+	fsOptions.FS = mfs
+	return &fsOptions
+}
+
+// newMapFSTemplate returns the templates of testData read from a MapFS, see mapFSOptions
+func newMapFSTemplate(t *testing.T, extra map[string]string) *Template {
+	t.Helper()
+
+	tpl, err := New("./testData", mapFSOptions(t, extra))
+	require.NoError(t, err)
+
+	return tpl
+}
+
+func Test_MapFS(t *testing.T) {
+	osTpl, err := New("./testData", options)
+	require.NoError(t, err)
+
+	fsTpl := newMapFSTemplate(t, nil)
+
+	d := struct{ Name string }{Name: "philippta"}
+	tests := []RenderOption{
+		{Template: "profile", Data: d},
+		{Template: "child"},
+		{Template: "info", Data: d},
+		{Template: "comp-demo"},
+		{Template: "comp-dialog"},
+		{Template: "p-to-end", Data: map[string]string{"name": "Paul"}},
+		{Template: "inFolder/grandchild"},
+		{Template: "inFolderWithShared/index"},
+		{Layout: "cast", Template: "multi", Data: d},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Template, func(t *testing.T) {
+			want := bytes.NewBuffer(nil)
+			require.NoError(t, osTpl.Render(want, tt))
+
+			got := bytes.NewBuffer(nil)
+			require.NoError(t, fsTpl.Render(got, tt))
+			assert.Equal(t, want.String(), got.String())
+		})
+	}
+
+	out, err := fsTpl.String("string", `{{define "main"}}{{template "modal/overlay"}}{{svg "attr"}}{{end}}`, nil)
+	require.NoError(t, err)
+	assert.Contains(t, out, "You cant see me!")
+	assert.Contains(t, out, "<svg")
+}
+
+func Test_templateCacheOthers(t *testing.T) {
+	tpl, err := New("./testData", options)
+	require.NoError(t, err)
+
+	buff := bytes.NewBuffer(nil)
+	err = tpl.Render(buff, RenderOption{Template: "inFolder/index"})
+	require.NoError(t, err)
+	assert.Equal(t, "A template\nwith no content", buff.String())
+
+	withOthers := RenderOption{Template: "inFolder/index", Others: []string{"inFolder/content"}}
+	assert.False(t, tpl.InCacheOption(withOthers))
+
+	buff.Reset()
+	err = tpl.Render(buff, withOthers)
+	require.NoError(t, err)
+	assert.Equal(t, "A templateA child", buff.String())
+	assert.True(t, tpl.InCacheOption(withOthers))
+	assert.True(t, tpl.InCache("", "inFolder/index"))
+
+	assert.NotEqual(t, newCacheKey("a", "b", nil), newCacheKey("", "a-b", nil))
+	assert.NotEqual(t, newCacheKey("", "a", []string{"b c"}), newCacheKey("", "a", []string{"b", "c"}))
+	assert.NotEqual(t, newCacheKey("", "a", []string{"b", "c"}), newCacheKey("", "a", []string{"c", "b"}))
+}
+
+func renderConcurrently(t testing.TB, tpl *Template, goroutines int, option RenderOption) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if err := tpl.Render(io.Discard, option); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
+
+// countingFS counts the times each file is opened
+type countingFS struct {
+	fs.FS
+	mtx   sync.Mutex
+	opens map[string]int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.mtx.Lock()
+	c.opens[name]++
+	c.mtx.Unlock()
+
+	return c.FS.Open(name)
+}
+
+func (c *countingFS) count(name string) int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.opens[name]
+}
+
+// newCountingTemplate returns a Template over testData, along with the countingFS it reads from
+func newCountingTemplate(tb testing.TB) (*Template, *countingFS) {
+	tb.Helper()
+
+	fSys := &countingFS{FS: os.DirFS("."), opens: map[string]int{}}
+	opts := *options
+	opts.FS = fSys
+	tpl, err := New("./testData", &opts)
+	require.NoError(tb, err)
+
+	return tpl, fSys
+}
+
+// opensPerParse returns how many times parsing the template of option opens its file
+func opensPerParse(tb testing.TB, option RenderOption) int {
+	tb.Helper()
+
+	tpl, fSys := newCountingTemplate(tb)
+	require.NoError(tb, tpl.Render(io.Discard, option))
+	opens := fSys.count(filepath.Join("testData", option.Template+".tmpl"))
+	require.NotZero(tb, opens)
+
+	return opens
+}
+
+func Test_concurrentCacheMiss(t *testing.T) {
+	d := struct{ Name string }{Name: "philippta"}
+	option := RenderOption{Template: "profile", Data: d}
+	perParse := opensPerParse(t, option)
+
+	tpl, fSys := newCountingTemplate(t)
+	renderConcurrently(t, tpl, 50, option)
+	assert.Equal(t, perParse, fSys.count("testData/profile.tmpl"))
+}
+
+func BenchmarkRender_concurrentCacheMiss(b *testing.B) {
+	d := struct{ Name string }{Name: "philippta"}
+	option := RenderOption{Template: "profile", Data: d}
+	perParse := opensPerParse(b, option)
+
+	var opens int
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tpl, fSys := newCountingTemplate(b)
+		b.StartTimer()
+
+		renderConcurrently(b, tpl, 64, option)
+		opens += fSys.count("testData/profile.tmpl")
+	}
+
+	b.ReportMetric(float64(opens)/float64(perParse)/float64(b.N), "parses/op")
+}
+
+func TestRenderFragment(t *testing.T) {
+	tpl, err := New("./testData", options)
+	require.NoError(t, err)
+
+	d := struct{ Name string }{Name: "philippta"}
+	tests := []struct {
+		name     string
+		option   RenderOption
+		expected string
+	}{
+		{
+			name:     "block from shared",
+			option:   RenderOption{Template: "profile", Fragment: "content", Data: d},
+			expected: "\n<div class=\"profile\">\n  Your username: PHILIPPTA\n</div>\n",
+		},
+		{
+			name:     "nested block",
+			option:   RenderOption{Template: "profile", Fragment: "user_content", Data: d},
+			expected: "\n  A username: philippta\n  ",
+		},
+		{
+			name:     "block from extended layout",
+			option:   RenderOption{Template: "child", Fragment: "dad-block"},
+			expected: "i'm the dadi'm the child",
+		},
+		{
+			name:     "with dynamic layout",
+			option:   RenderOption{Layout: "cast", Template: "multi", Fragment: "main", Data: d},
+			expected: "\n<div class=\"profile\">\n  Your username: PHILIPPTA\n</div>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buff := bytes.NewBuffer(nil)
+			require.NoError(t, tpl.Render(buff, tt.option))
+			assert.Equal(t, tt.expected, buff.String())
+		})
+	}
+
+	// the full page and the fragment share one cache entry
+	buff := bytes.NewBuffer(nil)
+	require.NoError(t, tpl.Render(buff, RenderOption{Template: "profile", Data: d}))
+	assert.Equal(t, "cast layout\n<div class=\"profile\">\n  Your username: PHILIPPTA\n</div>\n", buff.String())
+	assert.Len(t, tpl.snapshot().cache, 3)
+
+	err = tpl.Render(buff, RenderOption{Template: "profile", Fragment: "missing"})
+	assert.Error(t, err)
+}
+
+func Test_ComponentChildrenAndSlots(t *testing.T) {
+	tpl, err := New("./testData", options)
+	require.NoError(t, err)
+
+	buff := bytes.NewBuffer(nil)
+	data := map[string]any{"Name": "Ada", "Items": []string{"a", "b"}}
+	err = tpl.Render(buff, RenderOption{Template: "comp-slots", Data: data})
+	require.NoError(t, err)
+	assert.Equal(t, "\n<section class=\"panel\">\n\t<h2>Welcome</h2>\n\t<p>Hello, Ada!</p>\n\t\n<footer><div class=\"isCard\">\n\t<h1>Ada</h1>in the footer\n</div></footer>\n</section>\n"+
+		"\n<section class=\"panel\">\n\t<h2>a</h2>a of 2<footer></footer>\n</section>\n"+
+		"\n<section class=\"panel\">\n\t<h2>b</h2>b of 2<footer></footer>\n</section>\n",
+		buff.String())
+
+	// only variables are rewritten to refer to the data of the page
+	out, err := tpl.String("", `<Panel>{{ printf "$%d" 5 }} {{ $.Name }}</Panel>`, data)
+	require.NoError(t, err)
+	assert.Contains(t, out, "$5 Ada")
+}
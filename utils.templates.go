@@ -3,28 +3,69 @@ package templates
 import (
 	"fmt"
 	"io/fs"
-	"os"
 	"path/filepath"
 	"strings"
 )
 
 func (t *Template) InCache(layout, name string) bool {
+	return t.InCacheOption(RenderOption{Layout: layout, Template: name})
+}
+
+// InCacheOption reports whether the templates for option, including option.Others, are cached
+func (t *Template) InCacheOption(option RenderOption) bool {
 	var (
 		found bool
 	)
 
-	lookupName := fmt.Sprint("noLayout", "-", name)
-	if layout != "" {
-		lookupName = fmt.Sprint(layout, "-", name)
+	s := t.snapshot()
+	if option.RenderString {
+		return s.strings.get(keyOf(option)) != nil
 	}
 
-	t.mtx.RLock()
-	_, found = t.cache[lookupName]
-	t.mtx.RUnlock()
+	s.mtx.RLock()
+	_, found = s.cache[keyOf(option)]
+	s.mtx.RUnlock()
 
 	return found
 }
 
+// cacheKey identifies a cached template by its layout, template and the ordered list of other templates
+type cacheKey struct {
+	layout string
+	name   string
+	others string
+}
+
+func newCacheKey(layout, name string, others []string) cacheKey {
+	key := cacheKey{layout: layout, name: name}
+	if len(others) > 0 {
+		// quoting each name keeps ["a b"] and ["a", "b"] apart
+		key.others = fmt.Sprintf("%q", others)
+	}
+
+	return key
+}
+
+// keyOf returns the cache key of the template option renders
+func keyOf(option RenderOption) cacheKey {
+	if option.RenderString {
+		return newCacheKey(option.Layout, newInlineSource(option).name, option.Others)
+	}
+
+	return newCacheKey(option.Layout, option.Template, option.Others)
+}
+
+func (k cacheKey) compare(o cacheKey) int {
+	if c := strings.Compare(k.layout, o.layout); c != 0 {
+		return c
+	}
+	if c := strings.Compare(k.name, o.name); c != 0 {
+		return c
+	}
+
+	return strings.Compare(k.others, o.others)
+}
+
 // isFolder checks if a folder exists in the template folder
 func (t *Template) isFolder(name string) bool {
 	var templateName string = name
@@ -32,7 +73,7 @@ func (t *Template) isFolder(name string) bool {
 		templateName = filepath.Join(t.root, name)
 	}
 
-	fi, err := os.Stat(templateName)
+	fi, err := fs.Stat(t.fSys, t.fsPath(templateName))
 	if err != nil {
 		return false
 	}
@@ -47,7 +88,7 @@ func (t *Template) isInFolder(name string) (string, bool) {
 		return "", false
 	}
 
-	fi, err := os.Stat(fdr)
+	fi, err := fs.Stat(t.fSys, t.fsPath(fdr))
 	if err != nil {
 		return "", false
 	}
@@ -56,7 +97,7 @@ func (t *Template) isInFolder(name string) (string, bool) {
 }
 
 func (t *Template) pathExists(name string) bool {
-	_, err := os.Stat(name)
+	_, err := fs.Stat(t.fSys, t.fsPath(name))
 
 	return err == nil
 }
@@ -80,10 +121,22 @@ func (t *Template) stripFileName(name string) string {
 	return name
 }
 
+// fsPath converts a path rooted at t.root into a path within t.fSys
+func (t *Template) fsPath(name string) string {
+	root := filepath.Clean(t.root)
+	name = filepath.Clean(name)
+	if name == root {
+		return "."
+	}
+
+	name = strings.TrimPrefix(name, root+string(filepath.Separator))
+	return filepath.ToSlash(name)
+}
+
 // findFiles
 func (t *Template) findFiles(root, ext string) (filenames []string, err error) {
 
-	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+	err = fs.WalkDir(t.fSys, t.fsPath(root), func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		} else if d.IsDir() {
@@ -91,7 +144,7 @@ func (t *Template) findFiles(root, ext string) (filenames []string, err error) {
 		}
 
 		if strings.HasSuffix(path, ext) {
-			filenames = append(filenames, path)
+			filenames = append(filenames, filepath.Join(t.root, filepath.FromSlash(path)))
 		}
 		return nil
 	})
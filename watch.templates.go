@@ -0,0 +1,114 @@
+package templates
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watch polls the template root (which includes the shared and components folders)
+// every interval and evicts the cache entries affected by changed files
+func (t *Template) watch(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	stop := make(chan struct{})
+	t.stopWatch = stop
+	stamps := t.fileStamps()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				current := t.fileStamps()
+				t.filesChanged(changedFiles(stamps, current))
+				stamps = current
+			}
+		}
+	}()
+}
+
+// Close stops the file watcher started when TemplateOptions.Watch is set
+func (t *Template) Close() error {
+	if t.stopWatch != nil {
+		close(t.stopWatch)
+		t.stopWatch = nil
+	}
+
+	return nil
+}
+
+// fileStamps records the modification time and size of every template under the root
+func (t *Template) fileStamps() map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	_ = fs.WalkDir(t.fSys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, t.ext) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		stamps[filepath.Join(t.root, filepath.FromSlash(path))] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		return nil
+	})
+
+	return stamps
+}
+
+type fileChange struct {
+	name     string
+	modified bool
+}
+
+// changedFiles lists files that were added, removed or modified between two sets of stamps
+func changedFiles(old, current map[string]fileStamp) []fileChange {
+	var changes []fileChange
+	for name, stamp := range current {
+		oldStamp, found := old[name]
+		if !found {
+			changes = append(changes, fileChange{name: name})
+		} else if !oldStamp.modTime.Equal(stamp.modTime) || oldStamp.size != stamp.size {
+			changes = append(changes, fileChange{name: name, modified: true})
+		}
+	}
+
+	for name := range old {
+		if _, found := current[name]; !found {
+			changes = append(changes, fileChange{name: name})
+		}
+	}
+
+	return changes
+}
+
+// filesChanged invalidates the cache entries affected by modified files.
+// adding or removing a file can change how references resolve, so it starts from a new snapshot
+func (t *Template) filesChanged(changes []fileChange) {
+	for _, change := range changes {
+		if !change.modified {
+			// keep serving the previous snapshot if the new one fails to parse
+			_ = t.reload(context.Background(), false)
+			return
+		}
+	}
+
+	for _, change := range changes {
+		_ = t.Invalidate(change.name)
+	}
+}
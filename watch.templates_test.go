@@ -0,0 +1,77 @@
+package templates
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyTestData copies the testData folder into a temporary folder that can be modified
+func copyTestData(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	err := filepath.WalkDir("testData", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(root, path[len("testData"):])
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, b, 0o644)
+	})
+	require.NoError(t, err)
+
+	return root
+}
+
+func Test_Watch(t *testing.T) {
+	root := copyTestData(t)
+
+	watchOptions := *options
+	watchOptions.Watch = true
+	watchOptions.WatchInterval = 10 * time.Millisecond
+	tpl, err := New(root, &watchOptions)
+	require.NoError(t, err)
+	defer tpl.Close()
+
+	render := func(name string) string {
+		buff := bytes.NewBuffer(nil)
+		require.NoError(t, tpl.Render(buff, RenderOption{Template: name, Data: map[string]string{"name": "Paul"}}))
+		return buff.String()
+	}
+
+	assert.Equal(t, "i'm the grandpai'm the dadi'm the child", render("child"))
+	assert.Equal(t, ", This is solo act!", render("solo"))
+
+	// modifying a layout in the extends chain evicts only the templates built from it
+	err = os.WriteFile(filepath.Join(root, "grandpa.tmpl"), []byte(`i'm the new grandpa{{ block "dad-block" . }}{{ end }}`), 0o644)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return !tpl.InCache("", "child")
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, tpl.InCache("", "solo"))
+	assert.Equal(t, "i'm the new grandpai'm the dadi'm the child", render("child"))
+
+	// modifying a component rebuilds the component templates
+	err = os.WriteFile(filepath.Join(root, "components", "hi.tmpl"), []byte(`{{ if not ._isEnd }}Hey {{ .name }}{{ end }}`), 0o644)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return render("p-to-end") == "Hey Paul"
+	}, time.Second, 10*time.Millisecond)
+}